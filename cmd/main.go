@@ -2,22 +2,31 @@ package main
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"github.com/eiannone/keyboard"
 	"github.com/gookit/color"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/matinhimself/trie/models"
-	"github.com/matinhimself/trie/pkg/hashtable"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/storage"
 	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"unicode"
 )
 
 const (
 	ClearScreen       = "\033[H\033[2J"
 	InlineSearchCount = 5
+	TopStudentsCount  = 10
+	// StudentSeed seeds the student hasher, so students land in the same
+	// buckets on every run.
+	StudentSeed = 0x5eed_51d5
+	// DataDir holds the students' log and snapshot.
+	DataDir = "students.db"
 )
 
 var (
@@ -26,6 +35,10 @@ var (
 	Succeed = Green
 )
 
+// Students maps student ids to students and persists every change to
+// DataDir.
+type Students = storage.Store[models.StudentID, *models.Student]
+
 var (
 	CyanBackground = "\033[42m\033[30m%s\033[0m\n"
 	Red            = color.Red.Sprint
@@ -37,8 +50,34 @@ var (
 
 func main() {
 	fmt.Print(ClearScreen)
-	hm, _ := hashtable.NewHashTable(1000)
-	menu(hm)
+	hm, _ := generic.NewHashTable[models.StudentID, *models.Student](1000, nil,
+		generic.WithHasher(generic.XXHash{}),
+		generic.WithSeed(StudentSeed),
+		generic.WithAutoResize(0.25, 2),
+		generic.WithIndex("discipline", func(st *models.Student) []string {
+			return []string{strings.ToUpper(st.Discipline)}
+		}),
+		generic.WithIndex("name", func(st *models.Student) []string {
+			return generic.Tokens(st.FullName)
+		}),
+		generic.WithOrderedIndex("gpa", func(st *models.Student) float64 {
+			return st.GPA
+		}),
+	)
+	store, err := storage.Open[models.StudentID, *models.Student](DataDir, hm,
+		generic.JSONCodec[models.StudentID, *models.Student]{},
+		storage.WithCompactEvery(1000),
+	)
+	if err != nil {
+		log.Fatal(Red(err))
+	}
+	defer store.Close()
+	menu(store)
+}
+
+// saveFailed reports a change that couldn't be persisted.
+func saveFailed(err error) {
+	WaitForKey(ErrC(fmt.Sprintf("Couldn't save students: %v", err)))
 }
 
 func help() {
@@ -49,9 +88,12 @@ func help() {
 	fmt.Println(Teal("  F3 "), " to load from exported csv.")
 	fmt.Println(Teal("  F4 "), " to export students into a csv file.")
 	fmt.Println(Teal("  F5 "), " to show manual.")
+	fmt.Println(Teal("  F6 "), " to show bucket distribution.")
+	fmt.Println(Teal("  F7 "), " to search students by name or discipline.")
+	fmt.Println(Teal("  F8 "), " to show the top students by GPA.")
 }
 
-func menu(hm *hashtable.HashTable) {
+func menu(hm *Students) {
 
 	if err := keyboard.Open(); err != nil {
 		panic(err)
@@ -94,9 +136,8 @@ LOOP:
 					typed = searchRes[selection-1+startIndex]
 					selection, startIndex = 0, 0
 				} else {
-					res, found := hm.Get(typed)
+					stu, found := hm.Get(models.StudentID(typed))
 					if found {
-						stu := res.Value.(*models.Student)
 						studentProfile(stu, &typed, hm)
 					} else {
 						continue
@@ -130,9 +171,11 @@ LOOP:
 			{
 				fmt.Print(ClearScreen)
 				st := addStudent()
-				_, found := hm.Get(string(st.StudentID))
+				_, found := hm.Get(st.StudentID)
 				if !found {
-					hm.Set(st)
+					if err := hm.Set(st.StudentID, st); err != nil {
+						saveFailed(err)
+					}
 				} else {
 					WaitForKey(ErrC("Student ID: " + st.StudentID + " is taken."))
 				}
@@ -142,33 +185,8 @@ LOOP:
 		case keyboard.KeyF2:
 			{
 				fmt.Print(ClearScreen)
-				t := table.NewWriter()
-				t.SetOutputMirror(os.Stdout)
-				t.AppendHeader(table.Row{"Student ID", "Name", "Field", "GPA"})
-				t.SetAutoIndex(true)
-				t.SetStyle(table.StyleLight)
-				if len(typed) > 0 {
-					for _, pair := range hm.GetPairsWithPrefix(typed) {
-						st := pair.Value.(*models.Student)
-						t.AppendRow(table.Row{
-							pair.Key,
-							st.FullName,
-							st.Discipline,
-							fmt.Sprintf("%.2f", st.GPA),
-						})
-					}
-				} else {
-					for _, pair := range hm.GetAllPairs() {
-						st := pair.Value.(*models.Student)
-						t.AppendRow(table.Row{
-							pair.Key,
-							st.FullName,
-							st.Discipline,
-							fmt.Sprintf("%.2f", st.GPA),
-						})
-					}
-				}
-				t.Render()
+				students, _ := hm.Query().KeyPrefix(typed).Run()
+				renderStudents(students)
 				continue
 			}
 		case keyboard.KeyF3:
@@ -182,6 +200,7 @@ LOOP:
 					continue LOOP
 				}
 				r := csv.NewReader(f)
+				var pairs []generic.Pair[models.StudentID, *models.Student]
 				for {
 					record, err := r.Read()
 					if err == io.EOF {
@@ -204,9 +223,14 @@ LOOP:
 						continue
 					}
 					st := models.NewStudent(name, models.StudentID(studentID), gpa, dic)
-					hm.Set(st)
+					pairs = append(pairs, generic.Pair[models.StudentID, *models.Student]{Key: st.StudentID, Value: st})
+				}
+				results, err := hm.SetMany(pairs)
+				if err != nil {
+					saveFailed(err)
+				} else {
+					WaitForKey(ErrC(importSummary(results)))
 				}
-				WaitForKey(ErrC("Students imported successfully."))
 				fmt.Printf("%s", ClearScreen)
 				fmt.Println(typed)
 				f.Close()
@@ -225,6 +249,26 @@ LOOP:
 				help()
 				continue
 			}
+		case keyboard.KeyF6:
+			{
+				fmt.Print(ClearScreen)
+				showDistribution(hm)
+				WaitForKey("")
+				fmt.Print(ClearScreen)
+			}
+		case keyboard.KeyF7:
+			{
+				fmt.Print(ClearScreen)
+				searchStudents(hm)
+				continue
+			}
+		case keyboard.KeyF8:
+			{
+				fmt.Print(ClearScreen)
+				top, _ := hm.Query().OrderBy("gpa", true).Limit(TopStudentsCount).Run()
+				renderStudents(top)
+				continue
+			}
 		case keyboard.KeyEsc:
 			break LOOP
 		default:
@@ -262,7 +306,7 @@ LOOP:
 	}
 }
 
-func studentProfile(student *models.Student, typed *string, hm *hashtable.HashTable) {
+func studentProfile(student *models.Student, typed *string, hm *Students) {
 
 	_counter := 0
 	for {
@@ -297,7 +341,9 @@ func studentProfile(student *models.Student, typed *string, hm *hashtable.HashTa
 		}
 		if secKey == keyboard.KeyEnter {
 			if _counter == 0 {
-				hm.Delete(student.GetKey())
+				if _, err := hm.Delete(student.StudentID); err != nil {
+					saveFailed(err)
+				}
 				*typed = (*typed)[:len(*typed)-1]
 				break
 			} else if _counter == 1 {
@@ -321,7 +367,7 @@ func min(x, y int) int {
 	return y
 }
 
-func export(hm *hashtable.HashTable) {
+func export(hm *Students) {
 	file, err := os.Create("export.csv")
 	if err != nil {
 		println("adsa", err)
@@ -338,7 +384,7 @@ func export(hm *hashtable.HashTable) {
 		if pair.Value == nil {
 			continue
 		}
-		student := pair.Value.(*models.Student)
+		student := pair.Value
 		err := writer.Write([]string{string(student.StudentID), student.FullName,
 			student.Discipline, fmt.Sprintf("%.2f", student.GPA)})
 		if err != nil {
@@ -348,6 +394,66 @@ func export(hm *hashtable.HashTable) {
 
 }
 
+// importSummary counts the imported students by what happened to them.
+func importSummary(results []generic.SetResult) string {
+	counts := make(map[generic.SetStatus]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	return fmt.Sprintf("Students imported: %d new, %d updated, %d rejected.",
+		counts[generic.Inserted], counts[generic.Updated], counts[generic.Rejected])
+}
+
+// renderStudents prints students as a table.
+func renderStudents(pairs []generic.Pair[models.StudentID, *models.Student]) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Student ID", "Name", "Field", "GPA"})
+	t.SetAutoIndex(true)
+	t.SetStyle(table.StyleLight)
+	for _, pair := range pairs {
+		st := pair.Value
+		t.AppendRow(table.Row{
+			pair.Key,
+			st.FullName,
+			st.Discipline,
+			fmt.Sprintf("%.2f", st.GPA),
+		})
+	}
+	t.Render()
+}
+
+// searchStudents lists the students of a discipline, or those with a
+// name starting with the typed words.
+func searchStudents(hm *Students) {
+	query := getKeyboardInput(Text(fmt.Sprintf("%-12s", "Search:")), "")
+	fmt.Print(ClearScreen)
+	pairs, _ := hm.Query().Where(generic.Eq("discipline", strings.ToUpper(strings.TrimSpace(query)))).Run()
+	if len(pairs) == 0 {
+		q := hm.Query()
+		for _, word := range generic.Tokens(query) {
+			q.Where(generic.HasPrefix("name", word))
+		}
+		pairs, _ = q.Run()
+	}
+	renderStudents(pairs)
+}
+
+func showDistribution(hm *Students) {
+	d := hm.Distribution()
+	fmt.Println(Magenta("Bucket distribution"))
+	fmt.Printf("%-15s %d\n%-15s %d\n%-15s %.2f\n", "Buckets:", d.Buckets,
+		"Students:", hm.Len(), "Load factor:", hm.LoadFactor())
+	fmt.Printf("%-15s %d\n%-15s %.2f\n%-15s %.2f\n", "Longest chain:", d.Max,
+		"Mean:", d.Mean, "Variance:", d.Variance)
+	fmt.Printf("%-15s %.1f (uniform ~%d)\n%-15s %.1f%%\n", "Chi-square:", d.ChiSquare,
+		d.Buckets-1, "Empty buckets:", d.EmptyRatio*100)
+	fmt.Println(Teal("Chain length  Buckets"))
+	for n, count := range d.Histogram {
+		fmt.Printf("%12d  %d\n", n, count)
+	}
+}
+
 func getKeyboardInput(Fixed, placeHolder string) string {
 	typed := placeHolder
 	fmt.Print(ClearScreen)
@@ -380,7 +486,10 @@ func getKeyboardInput(Fixed, placeHolder string) string {
 	return typed
 }
 
-func editStudent(st *models.Student, hm *hashtable.HashTable) {
+func editStudent(st *models.Student, hm *Students) {
+	// Remember which version is edited, so saving doesn't overwrite a
+	// change made in the meantime.
+	_, version, _ := hm.GetVersioned(st.StudentID)
 
 	fmt.Print(ClearScreen)
 	var curString string
@@ -409,18 +518,28 @@ func editStudent(st *models.Student, hm *hashtable.HashTable) {
 	curString += sGpa + "\n"
 
 	if string(st.StudentID) == stId {
-		st.UpdateStudent(name, st.StudentID, gpa, dec)
+		tempSt := models.NewStudent(name, st.StudentID, gpa, dec)
+		_, err := hm.CompareAndSet(st.StudentID, tempSt, version)
+		var conflict *generic.ConflictError
+		if errors.As(err, &conflict) {
+			WaitForKey(ErrC("Student " + stId + " was changed by someone else, your changes are not saved."))
+		} else if err != nil {
+			saveFailed(err)
+		}
 	} else {
-
-		_, found := hm.Get(stId)
-		if found {
+		// Move the student to the new id at once, so nobody sees it under
+		// neither id or takes the id in between.
+		tempSt := models.NewStudent(name, models.StudentID(stId), gpa, dec)
+		_, err := hm.Rekey(st.StudentID, tempSt.StudentID, tempSt)
+		var conflict *generic.ConflictError
+		if errors.As(err, &conflict) {
 			WaitForKey(ErrC("Student ID " + stId + " is taken."))
 
 			editStudent(st, hm)
-		} else {
-			tempSt := models.NewStudent(name, models.StudentID(stId), gpa, dec)
-			hm.Delete(string(st.StudentID))
-			hm.Set(tempSt)
+		} else if errors.Is(err, generic.ErrNotFound) {
+			WaitForKey(ErrC("Student " + string(st.StudentID) + " was deleted by someone else, your changes are not saved."))
+		} else if err != nil {
+			saveFailed(err)
 		}
 	}
 
@@ -1,10 +1,14 @@
 module github.com/matinhimself/trie
 
-go 1.15
+go 1.18
 
 require (
 	github.com/eiannone/keyboard v0.0.0-20200508000154-caf4b762e807
 	github.com/gookit/color v1.3.6
 	github.com/jedib0t/go-pretty/v6 v6.0.6
+)
+
+require (
+	github.com/mattn/go-runewidth v0.0.9 // indirect
 	golang.org/x/sys v0.0.0-20210113000019-eaf3bda374d2 // indirect
 )
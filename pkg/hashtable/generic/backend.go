@@ -0,0 +1,174 @@
+package generic
+
+// backend stores the entries of one table generation. An index is a bucket
+// for separate chaining and a slot for open addressing; the trie stores it
+// for every key, so lookups never probe.
+type backend[K comparable, V any] interface {
+	// size returns the number of buckets or slots.
+	size() int
+	// insert stores an entry for a new key and returns its index. moved is
+	// called for every other entry that got a new index on the way.
+	insert(e entry[K, V], moved func(e *entry[K, V], index uint64)) uint64
+	// lookup returns the entry of key stored at index.
+	lookup(index uint64, key string) *entry[K, V]
+	// remove deletes the entry of key stored at index. moved is called for
+	// every other entry that got a new index on the way.
+	remove(index uint64, key string, moved func(e *entry[K, V], index uint64)) bool
+	// drain removes and returns all entries stored at index, without moving
+	// any other entry. It is used to empty a table that is being retired.
+	drain(index uint64) []entry[K, V]
+	// chain returns the entries stored at index.
+	chain(index uint64) []entry[K, V]
+}
+
+// chaining is the separate chaining backend: every bucket holds a slice of
+// the entries hashed to it.
+type chaining[K comparable, V any] [][]entry[K, V]
+
+func newChaining[K comparable, V any](size int, chainCap int) chaining[K, V] {
+	c := make(chaining[K, V], size)
+	for i := range c {
+		c[i] = make([]entry[K, V], 0, chainCap)
+	}
+	return c
+}
+
+func (c chaining[K, V]) size() int {
+	return len(c)
+}
+
+func (c chaining[K, V]) insert(e entry[K, V], _ func(*entry[K, V], uint64)) uint64 {
+	index := e.hash % uint64(len(c))
+	c[index] = append(c[index], e)
+	return index
+}
+
+func (c chaining[K, V]) lookup(index uint64, key string) *entry[K, V] {
+	chain := c[index]
+	for i := range chain {
+		if chain[i].skey == key {
+			return &chain[i]
+		}
+	}
+	return nil
+}
+
+func (c chaining[K, V]) remove(index uint64, key string, _ func(*entry[K, V], uint64)) bool {
+	chain := c[index]
+	for i, e := range chain {
+		if e.skey == key {
+			c[index] = append(chain[:i], chain[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c chaining[K, V]) drain(index uint64) []entry[K, V] {
+	chain := c[index]
+	c[index] = nil
+	return chain
+}
+
+func (c chaining[K, V]) chain(index uint64) []entry[K, V] {
+	return c[index]
+}
+
+// maxOpenLoad is the highest load factor an open addressing table is
+// allowed to reach before it has to grow.
+const maxOpenLoad = 0.9
+
+type slot[K comparable, V any] struct {
+	entry entry[K, V]
+	// dist is the distance of the entry from its home slot.
+	dist uint32
+	used bool
+}
+
+// robinHood is the open addressing backend. Entries live directly in a
+// flat slot array and are placed by linear probing, where an entry that
+// is further from its home slot takes over the slot of a closer one.
+// Deletes shift the following entries back instead of leaving tombstones.
+type robinHood[K comparable, V any] []slot[K, V]
+
+func newRobinHood[K comparable, V any](size int) robinHood[K, V] {
+	return make(robinHood[K, V], size)
+}
+
+func (r robinHood[K, V]) size() int {
+	return len(r)
+}
+
+// insert places e by Robin Hood probing. The table must not be full,
+// which the load factor limit of maxOpenLoad guarantees.
+func (r robinHood[K, V]) insert(e entry[K, V], moved func(*entry[K, V], uint64)) uint64 {
+	size := uint64(len(r))
+	index := e.hash % size
+	placed := false
+	var result uint64
+
+	curr, dist := e, uint32(0)
+	for {
+		s := &r[index]
+		if !s.used || s.dist < dist {
+			// Take the slot. If it was in use, carry its entry on.
+			evicted, evictedDist, wasUsed := s.entry, s.dist, s.used
+			s.entry, s.dist, s.used = curr, dist, true
+			if !placed {
+				placed = true
+				result = index
+			} else {
+				moved(&s.entry, index)
+			}
+			if !wasUsed {
+				return result
+			}
+			curr, dist = evicted, evictedDist
+		}
+		index = (index + 1) % size
+		dist++
+	}
+}
+
+func (r robinHood[K, V]) lookup(index uint64, key string) *entry[K, V] {
+	if s := &r[index]; s.used && s.entry.skey == key {
+		return &s.entry
+	}
+	return nil
+}
+
+// remove empties the slot at index and shifts the following entries of
+// the probe run back by one slot.
+func (r robinHood[K, V]) remove(index uint64, key string, moved func(*entry[K, V], uint64)) bool {
+	if r.lookup(index, key) == nil {
+		return false
+	}
+	size := uint64(len(r))
+	for {
+		next := (index + 1) % size
+		if s := &r[next]; !s.used || s.dist == 0 {
+			r[index] = slot[K, V]{}
+			return true
+		}
+		r[index] = r[next]
+		r[index].dist--
+		moved(&r[index].entry, index)
+		index = next
+	}
+}
+
+func (r robinHood[K, V]) drain(index uint64) []entry[K, V] {
+	s := r[index]
+	if !s.used {
+		return nil
+	}
+	r[index] = slot[K, V]{}
+	return []entry[K, V]{s.entry}
+}
+
+func (r robinHood[K, V]) chain(index uint64) []entry[K, V] {
+	if !r[index].used {
+		return nil
+	}
+	return []entry[K, V]{r[index].entry}
+}
@@ -0,0 +1,157 @@
+package generic
+
+import "fmt"
+
+// SetStatus tells what SetMany did with a pair.
+type SetStatus int
+
+const (
+	// Inserted means the key was new.
+	Inserted SetStatus = iota + 1
+	// Updated means the value of an existing key was replaced.
+	Updated
+	// Rejected means the pair was not set, see SetResult.Err.
+	Rejected
+)
+
+func (s SetStatus) String() string {
+	switch s {
+	case Inserted:
+		return "inserted"
+	case Updated:
+		return "updated"
+	case Rejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// SetResult is the outcome of setting one pair of SetMany.
+type SetResult struct {
+	Status SetStatus
+	// Version is the version of the entry after the set, Err the reason a
+	// rejected pair was not set.
+	Version uint64
+	Err     error
+}
+
+// SetMany sets all pairs like Set does one by one, and returns what
+// happened to each of them. A pair whose key the prefix index doesn't
+// accept is rejected, see trie.PrefixIndex.Accepts.
+//
+// The table is locked once, grown to fit all pairs ahead when it resizes
+// itself, and the keys are claimed in the prefix index in a single call.
+// A table with a capacity or expiring entries sets the pairs one by one,
+// still under a single lock.
+func (hm *HashTable[K, V]) SetMany(pairs []Pair[K, V]) []SetResult {
+	results, _ := hm.bulkSet(pairs, false, nil)
+	return results
+}
+
+// LoadSorted is SetMany for pairs ordered by the string form of their
+// keys, which lets the trie build every node once while following the
+// keys. A pair whose key sorts before the key of the last pair set is
+// rejected.
+func (hm *HashTable[K, V]) LoadSorted(pairs []Pair[K, V]) []SetResult {
+	results, _ := hm.bulkSet(pairs, true, nil)
+	return results
+}
+
+// bulkSet is LoadSorted if sorted is set, SetMany otherwise. Once the
+// pairs are checked, and before any is set, prepare is called with the
+// pairs that will be set, unless it is nil. If it returns an error,
+// nothing is set and bulkSet returns it. prepare is called with the table
+// locked, so it must not use the table.
+func (hm *HashTable[K, V]) bulkSet(pairs []Pair[K, V], sorted bool, prepare func(accepted []Pair[K, V]) error) ([]SetResult, error) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	results := make([]SetResult, len(pairs))
+	entries := make([]entry[K, V], 0, len(pairs))
+	// slots holds the position in results of every entry.
+	slots := make([]int, 0, len(pairs))
+	for i, p := range pairs {
+		skey := hm.keyString(p.Key)
+		if err := hm.checkKey(skey); err != nil {
+			results[i] = SetResult{Status: Rejected, Err: err}
+			continue
+		}
+		if sorted && len(entries) > 0 && skey < entries[len(entries)-1].skey {
+			results[i] = SetResult{Status: Rejected, Err: fmt.Errorf("key %q is out of order after %q", skey, entries[len(entries)-1].skey)}
+			continue
+		}
+		entries = append(entries, entry[K, V]{key: p.Key, skey: skey, value: p.Value, hash: hm.hash(p.Key, skey, p.Value)})
+		slots = append(slots, i)
+	}
+	if prepare != nil {
+		accepted := make([]Pair[K, V], len(slots))
+		for j, i := range slots {
+			accepted[j] = pairs[i]
+		}
+		if err := prepare(accepted); err != nil {
+			return nil, err
+		}
+	}
+
+	if hm.cache != nil || hm.expiring() {
+		// Evictions and expiries remove entries on the way, the
+		// locations can't be claimed ahead.
+		for j, e := range entries {
+			_, updated := hm.set(e)
+			results[slots[j]] = setResult(updated, hm.revision)
+		}
+		return results, nil
+	}
+
+	hm.reserve(len(entries))
+	keys := make([]string, len(entries))
+	locations := make([]interface{}, len(entries))
+	for j, e := range entries {
+		keys[j] = e.skey
+		locations[j] = hm.buckets.location(hm.buckets.getIndex(e.hash))
+	}
+	stored, loaded := hm.tree.LoadOrStoreMany(keys, locations)
+
+	for j, e := range entries {
+		location := stored[j]
+		if loaded[j] && hm.openAddressing {
+			// Inserting the entries before may have moved this one.
+			if current, found := hm.tree.Search(e.skey); found {
+				location = *current
+			}
+		}
+		_, updated := hm.place(e, hm.buckets, hm.buckets.getIndex(e.hash), location, loaded[j])
+		results[slots[j]] = setResult(updated, hm.revision)
+	}
+	hm.maybeResize()
+	return results, nil
+}
+
+func setResult(updated bool, version uint64) SetResult {
+	if updated {
+		return SetResult{Status: Updated, Version: version}
+	}
+	return SetResult{Status: Inserted, Version: version}
+}
+
+// reserve finishes any ongoing resize and, if the table resizes itself,
+// grows it to hold n more entries within its maximum load factor. The
+// caller must hold the write lock.
+func (hm *HashTable[K, V]) reserve(n int) {
+	for hm.next != nil {
+		hm.rehashStep()
+	}
+	if hm.maxLoad <= 0 {
+		return
+	}
+	size := hm.size
+	for float64(hm.count+n) > hm.maxLoad*float64(size) {
+		size *= 2
+	}
+	if size > hm.size {
+		hm.startResize(size)
+		for hm.next != nil {
+			hm.rehashStep()
+		}
+	}
+}
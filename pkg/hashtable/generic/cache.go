@@ -0,0 +1,382 @@
+package generic
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionPolicy decides which key a table at its capacity evicts, see
+// WithCapacity. Keys are the string forms of the keys of the table. The
+// table serializes all calls, each should take constant time.
+type EvictionPolicy interface {
+	// Add records a new key.
+	Add(key string)
+	// Touch records a read or update of a key.
+	Touch(key string)
+	// Remove forgets a key.
+	Remove(key string)
+	// Victim returns the key to evict, false if there is none.
+	Victim() (string, bool)
+}
+
+// CacheStats counts the outcome of the key lookups of a table and the
+// entries it evicted, see WithCapacity.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+}
+
+// HitRatio returns the share of lookups that found their key.
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// cache bounds the number of entries of a table.
+type cache[K comparable, V any] struct {
+	// hits, misses and evictions are updated atomically, they come first
+	// to be 64 bit aligned.
+	hits, misses, evictions uint64
+
+	capacity int
+	// lock serializes the calls to policy, reads touch keys under the read
+	// lock of the table.
+	lock    sync.Mutex
+	policy  EvictionPolicy
+	onEvict func(K, V)
+	// logEvict is called with the key of every entry evicted, see
+	// tableHooks.OnEvict. While suspended is set, nothing is evicted.
+	logEvict  func(K)
+	suspended bool
+}
+
+// CacheStats returns the lookup and eviction counts of a table with a
+// capacity. Only Get, GetVersioned and ExpiresAt count as lookups, listing
+// keys by prefix or index neither counts nor marks them as used.
+func (hm *HashTable[K, V]) CacheStats() CacheStats {
+	c := hm.cache
+	if c == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// Capacity returns the number of entries the table holds at most, 0 if
+// it is unbounded. Size returns the number of buckets, which grows with
+// the entries instead.
+func (hm *HashTable[K, V]) Capacity() int {
+	if hm.cache == nil {
+		return 0
+	}
+	return hm.cache.capacity
+}
+
+// lookedUp counts a key lookup and touches the key if it was found. The
+// caller must hold the lock.
+func (hm *HashTable[K, V]) lookedUp(skey string, found bool) {
+	c := hm.cache
+	if c == nil {
+		return
+	}
+	if !found {
+		atomic.AddUint64(&c.misses, 1)
+		return
+	}
+	atomic.AddUint64(&c.hits, 1)
+	c.lock.Lock()
+	c.policy.Touch(skey)
+	c.lock.Unlock()
+}
+
+// cacheAdd records a key set for the first time, cacheTouch one set again
+// and cacheRemove one deleted. The caller must hold the write lock.
+func (hm *HashTable[K, V]) cacheAdd(skey string) {
+	if c := hm.cache; c != nil {
+		c.lock.Lock()
+		c.policy.Add(skey)
+		c.lock.Unlock()
+	}
+}
+
+func (hm *HashTable[K, V]) cacheTouch(skey string) {
+	if c := hm.cache; c != nil {
+		c.lock.Lock()
+		c.policy.Touch(skey)
+		c.lock.Unlock()
+	}
+}
+
+func (hm *HashTable[K, V]) cacheRemove(skey string) {
+	if c := hm.cache; c != nil {
+		c.lock.Lock()
+		c.policy.Remove(skey)
+		c.lock.Unlock()
+	}
+}
+
+// makeRoom evicts entries until a new one fits, unless skey is stored
+// already. The caller must hold the write lock.
+func (hm *HashTable[K, V]) makeRoom(skey string) {
+	c := hm.cache
+	if c == nil || hm.count < c.capacity || hm.lookupEntry(skey) != nil {
+		return
+	}
+	hm.evictDownTo(c.capacity - 1)
+}
+
+// evictDownTo evicts entries until the table holds at most n of them,
+// unless eviction is suspended. The caller must hold the write lock.
+func (hm *HashTable[K, V]) evictDownTo(n int) {
+	c := hm.cache
+	if c.suspended {
+		return
+	}
+	for hm.count > n {
+		c.lock.Lock()
+		victim, ok := c.policy.Victim()
+		c.lock.Unlock()
+		if !ok {
+			return
+		}
+		hm.evict(victim)
+	}
+}
+
+// evict removes the entry of skey, reporting it to the watchers and the
+// eviction callback. The caller must hold the write lock.
+func (hm *HashTable[K, V]) evict(skey string) {
+	e := hm.lookupEntry(skey)
+	if e == nil {
+		// The policy is out of step with the table, drop the key.
+		hm.cacheRemove(skey)
+		return
+	}
+	key, value := e.key, e.value
+	if hm.remove(skey, EventEvict) != EventEvict {
+		// It had expired, which made room just as well.
+		return
+	}
+	atomic.AddUint64(&hm.cache.evictions, 1)
+	if hm.cache.onEvict != nil {
+		hm.cache.onEvict(key, value)
+	}
+	if hm.cache.logEvict != nil {
+		hm.cache.logEvict(key)
+	}
+}
+
+// onEvict sets the logEvict function of the table, see tableHooks.OnEvict.
+func (hm *HashTable[K, V]) onEvict(fn func(K)) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+	if hm.cache != nil {
+		hm.cache.logEvict = fn
+	}
+}
+
+// suspendEviction suspends or resumes eviction, see
+// tableHooks.SuspendEviction.
+func (hm *HashTable[K, V]) suspendEviction(suspend bool) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+	if c := hm.cache; c != nil {
+		c.suspended = suspend
+		hm.evictDownTo(c.capacity)
+	}
+}
+
+// contains reports whether the table holds a key, see tableHooks.Contains.
+func (hm *HashTable[K, V]) contains(key K) bool {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	return hm.findEntry(hm.keyString(key)) != nil
+}
+
+// lru evicts the least recently used key.
+type lru struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+// NewLRU returns a policy evicting the least recently used key.
+func NewLRU() EvictionPolicy {
+	return &lru{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (p *lru) Add(key string) {
+	p.items[key] = p.order.PushBack(key)
+}
+
+func (p *lru) Touch(key string) {
+	if el, ok := p.items[key]; ok {
+		p.order.MoveToBack(el)
+	}
+}
+
+func (p *lru) Remove(key string) {
+	if el, ok := p.items[key]; ok {
+		p.order.Remove(el)
+		delete(p.items, key)
+	}
+}
+
+func (p *lru) Victim() (string, bool) {
+	if el := p.order.Front(); el != nil {
+		return el.Value.(string), true
+	}
+	return "", false
+}
+
+// lfuItem is a key of the lfu policy and the frequency list holding it.
+type lfuItem struct {
+	key  string
+	freq *list.Element
+}
+
+// lfuFreq is the list of the keys used count times, least recently used
+// first.
+type lfuFreq struct {
+	count int
+	keys  *list.List
+}
+
+// lfu evicts the least frequently used key, the least recently used of
+// those on a tie. The frequency lists are kept in ascending order, so
+// every operation moves a key by one list at most.
+type lfu struct {
+	freqs *list.List
+	items map[string]*list.Element
+}
+
+// NewLFU returns a policy evicting the least frequently used key.
+func NewLFU() EvictionPolicy {
+	return &lfu{freqs: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (p *lfu) Add(key string) {
+	first := p.freqs.Front()
+	if first == nil || first.Value.(*lfuFreq).count != 1 {
+		first = p.freqs.PushFront(&lfuFreq{count: 1, keys: list.New()})
+	}
+	p.items[key] = first.Value.(*lfuFreq).keys.PushBack(&lfuItem{key: key, freq: first})
+}
+
+func (p *lfu) Touch(key string) {
+	el, ok := p.items[key]
+	if !ok {
+		return
+	}
+	item := el.Value.(*lfuItem)
+	curr := item.freq
+	count := curr.Value.(*lfuFreq).count + 1
+	next := curr.Next()
+	if next == nil || next.Value.(*lfuFreq).count != count {
+		next = p.freqs.InsertAfter(&lfuFreq{count: count, keys: list.New()}, curr)
+	}
+	p.unlink(el)
+	item.freq = next
+	p.items[key] = next.Value.(*lfuFreq).keys.PushBack(item)
+}
+
+func (p *lfu) Remove(key string) {
+	if el, ok := p.items[key]; ok {
+		p.unlink(el)
+		delete(p.items, key)
+	}
+}
+
+// unlink takes the item of el out of its frequency list, dropping the list
+// once it is empty.
+func (p *lfu) unlink(el *list.Element) {
+	freq := el.Value.(*lfuItem).freq
+	keys := freq.Value.(*lfuFreq).keys
+	keys.Remove(el)
+	if keys.Len() == 0 {
+		p.freqs.Remove(freq)
+	}
+}
+
+func (p *lfu) Victim() (string, bool) {
+	if first := p.freqs.Front(); first != nil {
+		return first.Value.(*lfuFreq).keys.Front().Value.(*lfuItem).key, true
+	}
+	return "", false
+}
+
+// clockSlot is a position of the clock ring.
+type clockSlot struct {
+	key        string
+	used, live bool
+}
+
+// clock approximates LRU with a ring of keys and a reference bit per key:
+// the hand passes over keys used since it last came by, clearing their
+// bit, and evicts the first key without it.
+type clock struct {
+	ring  []clockSlot
+	hand  int
+	slots map[string]int
+	// free holds the positions of removed keys for reuse.
+	free []int
+}
+
+// NewClock returns a policy evicting keys by the CLOCK algorithm.
+func NewClock() EvictionPolicy {
+	return &clock{slots: make(map[string]int)}
+}
+
+func (p *clock) Add(key string) {
+	slot := clockSlot{key: key, live: true}
+	if n := len(p.free); n > 0 {
+		i := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.ring[i] = slot
+		p.slots[key] = i
+		return
+	}
+	p.slots[key] = len(p.ring)
+	p.ring = append(p.ring, slot)
+}
+
+func (p *clock) Touch(key string) {
+	if i, ok := p.slots[key]; ok {
+		p.ring[i].used = true
+	}
+}
+
+func (p *clock) Remove(key string) {
+	if i, ok := p.slots[key]; ok {
+		p.ring[i] = clockSlot{}
+		p.free = append(p.free, i)
+		delete(p.slots, key)
+	}
+}
+
+// Victim sweeps at most twice around the ring, amortized constant time
+// as every pass clears the bits it passes.
+func (p *clock) Victim() (string, bool) {
+	if len(p.slots) == 0 {
+		return "", false
+	}
+	for {
+		if p.hand >= len(p.ring) {
+			p.hand = 0
+		}
+		s := &p.ring[p.hand]
+		p.hand++
+		if !s.live {
+			continue
+		}
+		if s.used {
+			s.used = false
+			continue
+		}
+		return s.key, true
+	}
+}
@@ -0,0 +1,76 @@
+package generic
+
+// Distribution describes how evenly the hash spreads the keys over the
+// buckets of a HashTable. Every entry is counted in its home bucket, the
+// bucket its hash selects, so for open addressing the chain length of a
+// slot is the number of entries whose probe starts there. While a resize
+// is in progress entries are counted as if they had been migrated already.
+type Distribution struct {
+	Buckets int
+	Entries int
+	// Histogram holds at index n the number of buckets with n entries.
+	Histogram []int
+	// Max, Mean and Variance describe the chain lengths.
+	Max            int
+	Mean, Variance float64
+	// ChiSquare is Pearson's chi-square statistic of the chain lengths
+	// against a uniform distribution. A good hash scores close to
+	// Buckets-1, much higher scores mean the keys cluster.
+	ChiSquare  float64
+	EmptyRatio float64
+	// LoadFactor is the number of entries per bucket of the table in
+	// use, the figure WithAutoResize checks against its bounds.
+	LoadFactor float64
+}
+
+// Distribution returns statistics about the chain lengths of the table,
+// for evaluating hash functions and table sizes.
+func (hm *HashTable[K, V]) Distribution() Distribution {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	newest := hm.buckets
+	if hm.next != nil {
+		newest = hm.next
+	}
+	lengths := make([]int, newest.size())
+	for _, t := range hm.tables() {
+		for i := 0; i < t.size(); i++ {
+			for _, e := range t.chain(uint64(i)) {
+				lengths[newest.getIndex(e.hash)]++
+			}
+		}
+	}
+
+	max := 0
+	for _, n := range lengths {
+		if n > max {
+			max = n
+		}
+	}
+	d := Distribution{Buckets: len(lengths), Entries: hm.count, Histogram: make([]int, max+1)}
+	for _, n := range lengths {
+		d.Histogram[n]++
+	}
+	d.LoadFactor = float64(hm.count) / float64(hm.size)
+	d.summarize()
+	return d
+}
+
+// summarize fills in the statistics derived from Buckets, Entries and
+// Histogram.
+func (d *Distribution) summarize() {
+	d.Max = len(d.Histogram) - 1
+	d.Mean = float64(d.Entries) / float64(d.Buckets)
+	d.Variance = 0
+	for n, count := range d.Histogram {
+		diff := float64(n) - d.Mean
+		d.Variance += float64(count) * diff * diff
+	}
+	d.Variance /= float64(d.Buckets)
+	d.ChiSquare = 0
+	if d.Mean > 0 {
+		d.ChiSquare = d.Variance * float64(d.Buckets) / d.Mean
+	}
+	d.EmptyRatio = float64(d.Histogram[0]) / float64(d.Buckets)
+}
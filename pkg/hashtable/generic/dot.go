@@ -0,0 +1,75 @@
+package generic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DOTOptions controls which part of a HashTable WriteDOT renders.
+type DOTOptions struct {
+	// Prefix restricts the graph to entries whose key starts with the
+	// given prefix. Buckets without such entries are left out.
+	Prefix string
+	// MaxDepth limits how many entries of each chain are drawn. The
+	// rest of a longer chain is drawn as a single node holding the
+	// number of hidden entries. Zero means no limit.
+	MaxDepth int
+	// ShowEmpty also draws buckets that hold no entries.
+	ShowEmpty bool
+}
+
+// WriteDOT writes the bucket layout of the hashtable to w in Graphviz DOT
+// format. Each bucket is drawn as a box labeled with its index, followed
+// by its chain of entries, so collisions show up as long chains.
+func (hm *HashTable[K, V]) WriteDOT(w io.Writer, opts DOTOptions) error {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph hashtable {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	for _, t := range hm.tables() {
+		// Both generations are drawn while a resize is in progress.
+		fmt.Fprintf(bw, "\tsubgraph cluster_g%d {\n", t.generation)
+		fmt.Fprintf(bw, "\t\tlabel=\"generation %d\";\n", t.generation)
+		writeDOTBuckets(bw, t, opts)
+		fmt.Fprintln(bw, "\t}")
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func writeDOTBuckets[K comparable, V any](w io.Writer, t *table[K, V], opts DOTOptions) {
+	for index := 0; index < t.size(); index++ {
+		chain := t.chain(uint64(index))
+		keys := make([]string, 0, len(chain))
+		for _, e := range chain {
+			if key := e.skey; strings.HasPrefix(key, opts.Prefix) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 && !opts.ShowEmpty {
+			continue
+		}
+
+		prev := fmt.Sprintf("g%db%d", t.generation, index)
+		fmt.Fprintf(w, "\t%s [label=\"%d\", style=filled, fillcolor=lightgrey];\n", prev, index)
+		for i, key := range keys {
+			id := fmt.Sprintf("%se%d", prev, i)
+			if opts.MaxDepth > 0 && i == opts.MaxDepth {
+				fmt.Fprintf(w, "\t%s [label=\"+%d more\", shape=plaintext];\n", id, len(keys)-i)
+				fmt.Fprintf(w, "\t%s -> %s;\n", prev, id)
+				break
+			}
+			fmt.Fprintf(w, "\t%s [label=%s, shape=ellipse];\n", id, strconv.Quote(key))
+			fmt.Fprintf(w, "\t%s -> %s;\n", prev, id)
+			prev = id
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package generic
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math/bits"
+	"sync"
+)
+
+// Hasher hashes the string form of a key. seed selects a member of the
+// hash function family; a table passes the same seed on every call.
+type Hasher interface {
+	Hash(key string, seed uint64) uint64
+}
+
+// le64 reads 8 bytes of s at i as a little endian integer.
+func le64(s string, i int) uint64 {
+	_ = s[i+7]
+	return uint64(s[i]) | uint64(s[i+1])<<8 | uint64(s[i+2])<<16 | uint64(s[i+3])<<24 |
+		uint64(s[i+4])<<32 | uint64(s[i+5])<<40 | uint64(s[i+6])<<48 | uint64(s[i+7])<<56
+}
+
+// le32 reads 4 bytes of s at i as a little endian integer.
+func le32(s string, i int) uint64 {
+	_ = s[i+3]
+	return uint64(s[i]) | uint64(s[i+1])<<8 | uint64(s[i+2])<<16 | uint64(s[i+3])<<24
+}
+
+// FNV1a implements the 64 bit FNV-1a hash. The seed is mixed into the
+// offset basis, seed 0 gives the standard FNV-1a.
+type FNV1a struct{}
+
+func (FNV1a) Hash(key string, seed uint64) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64) ^ seed
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
+
+// Jenkins implements Bob Jenkins' one-at-a-time hash. It produces 32 bit
+// hashes; the seed is folded into the initial state, seed 0 gives the
+// standard one-at-a-time hash.
+type Jenkins struct{}
+
+func (Jenkins) Hash(key string, seed uint64) uint64 {
+	h := uint32(seed) ^ uint32(seed>>32)
+	for i := 0; i < len(key); i++ {
+		h += uint32(key[i])
+		h += h << 10
+		h ^= h >> 6
+	}
+	h += h << 3
+	h ^= h >> 11
+	h += h << 15
+	return uint64(h)
+}
+
+// SipHash implements SipHash-2-4, a keyed hash that resists hash flooding
+// by keys chosen to collide. The seed is xored into both halves of the
+// 128 bit key.
+type SipHash struct {
+	K0, K1 uint64
+}
+
+func (s SipHash) Hash(key string, seed uint64) uint64 {
+	k0, k1 := s.K0^seed, s.K1^seed
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	i := 0
+	for ; i+8 <= len(key); i += 8 {
+		m := le64(key, i)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	// The last block holds the remaining bytes and the length.
+	var last [8]byte
+	copy(last[:], key[i:])
+	last[7] = byte(len(key))
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// XXHash implements the 64 bit xxHash (XXH64) with the seed as its seed.
+type XXHash struct{}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (XXHash) Hash(key string, seed uint64) uint64 {
+	n := len(key)
+	i := 0
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; i+32 <= n; i += 32 {
+			v1 = xxRound(v1, le64(key, i))
+			v2 = xxRound(v2, le64(key, i+8))
+			v3 = xxRound(v3, le64(key, i+16))
+			v4 = xxRound(v4, le64(key, i+24))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+
+	h += uint64(n)
+	for ; i+8 <= n; i += 8 {
+		h ^= xxRound(0, le64(key, i))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if i+4 <= n {
+		h ^= le32(key, i) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		i += 4
+	}
+	for ; i < n; i++ {
+		h ^= uint64(key[i]) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+// MapHash uses the runtime's hash/maphash. It is fast and of good quality,
+// but its seed is random per MapHash, so hashes differ between processes.
+// The seed passed by the table is mixed into the key. The zero MapHash
+// makes its random seed on first use.
+type MapHash struct {
+	once sync.Once
+	seed maphash.Seed
+}
+
+// NewMapHash returns a MapHash with a new random seed.
+func NewMapHash() *MapHash {
+	m := new(MapHash)
+	m.once.Do(m.makeSeed)
+	return m
+}
+
+func (m *MapHash) makeSeed() {
+	m.seed = maphash.MakeSeed()
+}
+
+func (m *MapHash) Hash(key string, seed uint64) uint64 {
+	m.once.Do(m.makeSeed)
+	var h maphash.Hash
+	h.SetSeed(m.seed)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], seed)
+	_, _ = h.Write(b[:])
+	_, _ = h.WriteString(key)
+	return h.Sum64()
+}
@@ -0,0 +1,541 @@
+// Package generic implements the hashtable of package hashtable for any
+// key and value type. Values are kept in buckets, and a prefix index maps
+// the string form of every key to the bucket holding it, which makes
+// prefix queries over the keys cheap.
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/trie"
+	"sync"
+	"time"
+)
+
+// entry is a key value pair stored in a bucket.
+type entry[K comparable, V any] struct {
+	key K
+	// skey is the key as stored in the prefix index.
+	skey  string
+	value V
+	hash  uint64
+	// version is the revision of the table that last set the entry.
+	version uint64
+	// expires is when the entry expires in Unix nanoseconds, 0 if never.
+	expires int64
+}
+
+// Pair is a key and the value associated with it.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// ErrKeyRejected is returned, wrapped with the key, by the changes of a
+// key the prefix index doesn't accept, see trie.PrefixIndex.Accepts.
+var ErrKeyRejected = errors.New("key isn't accepted by the prefix index")
+
+// HashTable is a wrapper for a trie tree and a hashtable. It stores each
+// value in a bucket of the hashtable and the bucket index in a trie tree,
+// keyed by the string form of the key.
+type HashTable[K comparable, V any] struct {
+	lock    sync.RWMutex
+	size    int
+	count   int
+	buckets *table[K, V]
+	tree    trie.PrefixIndex
+
+	// next is the table being grown or shrunk into while a resize is in
+	// progress, rehashIdx the first bucket of buckets not yet migrated.
+	next      *table[K, V]
+	rehashIdx int
+
+	// revision counts the sets, it versions the entries.
+	revision uint64
+
+	hashKey   func(K) uint64
+	hashValue func(V) uint64
+	keyString func(K) string
+	hasher    Hasher
+	// seed is passed to hasher on every call.
+	seed uint64
+
+	minSize          int
+	minLoad, maxLoad float64
+	openAddressing   bool
+
+	// indexes and ordered are the secondary indexes by name.
+	indexes map[string]*secondaryIndex[V]
+	ordered map[string]*orderedIndex[V]
+
+	// watchers are the subscriptions of Watch, each buffering up to
+	// watchBuffer events.
+	watchers    []*watcher[K, V]
+	watchBuffer int
+
+	// now is the clock expiry is checked against, expiry orders the keys
+	// of expiring entries by their expiry. stop and done end the janitor.
+	now       func() time.Time
+	expiry    *skipList
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// cache bounds the number of entries, nil if they are unbounded.
+	cache *cache[K, V]
+}
+
+// NewHashTable returns a hashtable with the given number of buckets that
+// places keys by hash, configured by the given options. hash may be nil if
+// WithHasher or WithValueHash is given instead.
+func NewHashTable[K comparable, V any](size int, hash func(K) uint64, opts ...Option) (*HashTable[K, V], error) {
+	hm := new(HashTable[K, V])
+	if size <= 0 {
+		return nil, errors.New("hashmap size should be > 1")
+	}
+
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	hm.hashKey = hash
+	hm.keyString = defaultKeyString[K]
+	if cfg.hashValue != nil {
+		fn, ok := cfg.hashValue.(func(V) uint64)
+		if !ok {
+			return nil, fmt.Errorf("value hash %T doesn't hash %T values", cfg.hashValue, *new(V))
+		}
+		hm.hashValue = fn
+	}
+	if cfg.keyString != nil {
+		fn, ok := cfg.keyString.(func(K) string)
+		if !ok {
+			return nil, fmt.Errorf("key formatter %T doesn't format %T keys", cfg.keyString, *new(K))
+		}
+		hm.keyString = fn
+	}
+	hm.hasher = cfg.hasher
+	hm.seed = cfg.seed
+	if cfg.watchBuffer < 0 {
+		return nil, errors.New("watch buffer should be >= 0")
+	}
+	hm.watchBuffer = cfg.watchBuffer
+	hm.indexes = make(map[string]*secondaryIndex[V], len(cfg.indexes))
+	for name, extract := range cfg.indexes {
+		fn, ok := extract.(func(V) []string)
+		if !ok {
+			return nil, fmt.Errorf("index %q: extractor %T doesn't take %T values", name, extract, *new(V))
+		}
+		hm.indexes[name] = newSecondaryIndex(fn)
+	}
+	hm.ordered = make(map[string]*orderedIndex[V], len(cfg.ordered))
+	for name, score := range cfg.ordered {
+		fn, ok := score.(func(V) float64)
+		if !ok {
+			return nil, fmt.Errorf("ordered index %q: score %T doesn't take %T values", name, score, *new(V))
+		}
+		hm.ordered[name] = newOrderedIndex(fn)
+	}
+	if hm.hashKey == nil && hm.hashValue == nil && hm.hasher == nil {
+		return nil, errors.New("hashtable needs a hash function")
+	}
+
+	hm.openAddressing = cfg.openAddressing
+	hm.buckets = hm.newTable(size, 0, 20)
+	hm.size = size
+	hm.count = 0
+	hm.tree = cfg.newIndex()
+	hm.minSize = size
+	hm.minLoad, hm.maxLoad = cfg.minLoad, cfg.maxLoad
+	if hm.openAddressing && (hm.maxLoad <= 0 || hm.maxLoad > maxOpenLoad) {
+		// An open addressing table can't hold more entries than slots.
+		hm.maxLoad = maxOpenLoad
+	}
+	if hm.openAddressing && hm.minLoad > maxOpenLoad/4 {
+		// Leave room for the writes done while shrinking.
+		hm.minLoad = maxOpenLoad / 4
+	}
+
+	if cfg.capacity < 0 {
+		return nil, errors.New("capacity should be >= 0")
+	}
+	if cfg.capacity > 0 {
+		hm.cache = &cache[K, V]{capacity: cfg.capacity, policy: NewLRU()}
+		if cfg.newPolicy != nil {
+			hm.cache.policy = cfg.newPolicy()
+		}
+	}
+	if cfg.onEvict != nil {
+		fn, ok := cfg.onEvict.(func(K, V))
+		if !ok {
+			return nil, fmt.Errorf("eviction callback %T doesn't take %T keys and %T values", cfg.onEvict, *new(K), *new(V))
+		}
+		if hm.cache == nil {
+			return nil, errors.New("eviction callback given without a capacity")
+		}
+		hm.cache.onEvict = fn
+	}
+
+	hm.now = cfg.now
+	if cfg.janitor > 0 {
+		hm.stop, hm.done = make(chan struct{}), make(chan struct{})
+		go hm.janitor(cfg.janitor)
+	}
+	return hm, nil
+}
+
+func defaultKeyString[K comparable](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+// Size returns the number of buckets.
+func (hm *HashTable[K, V]) Size() int {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	return hm.size
+}
+
+// Len returns the number of live entries, which the prefix index holds a
+// key for each. Expired entries not removed yet don't count.
+func (hm *HashTable[K, V]) Len() int {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	return hm.count - hm.expiredCount()
+}
+
+// LoadFactor returns the number of entries per bucket, the figure
+// WithAutoResize keeps within its bounds. Expired entries count until
+// they are removed, as they take up room in the buckets all the same.
+func (hm *HashTable[K, V]) LoadFactor() float64 {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+	return float64(hm.count) / float64(hm.size)
+}
+
+// Seed returns the seed passed to the Hasher of the table.
+func (hm *HashTable[K, V]) Seed() uint64 {
+	return hm.seed
+}
+
+// hash returns the hash of a key value pair, skey being the string form
+// of the key. A configured Hasher takes precedence over the hash
+// functions.
+func (hm *HashTable[K, V]) hash(key K, skey string, value V) uint64 {
+	switch {
+	case hm.hasher != nil:
+		return hm.hasher.Hash(skey, hm.seed)
+	case hm.hashValue != nil:
+		return hm.hashValue(value)
+	default:
+		return hm.hashKey(key)
+	}
+}
+
+// Set sets the value for an associated key in the hashmap and returns the
+// index of the bucket holding it. The entry no longer expires, even if it
+// did before, see SetWithTTL. A key the prefix index doesn't accept isn't
+// set, Set returns an error wrapping ErrKeyRejected instead, see
+// trie.PrefixIndex.Accepts.
+func (hm *HashTable[K, V]) Set(key K, value V) (uint64, error) {
+	return hm.setExpiring(key, value, 0, nil)
+}
+
+// setExpiring is Set for an entry expiring at expires in Unix
+// nanoseconds, 0 meaning never, calling prepare, unless it is nil, once
+// the key is checked and before the value is set. If prepare fails,
+// nothing is set and its error is returned. prepare is called with the
+// table locked, so it must not use the table.
+func (hm *HashTable[K, V]) setExpiring(key K, value V, expires int64, prepare func() error) (uint64, error) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	skey := hm.keyString(key)
+	if err := hm.checkKey(skey); err != nil {
+		return 0, err
+	}
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return 0, err
+		}
+	}
+	e := entry[K, V]{key: key, skey: skey, value: value, hash: hm.hash(key, skey, value), expires: expires}
+	index, _ := hm.set(e)
+	return index, nil
+}
+
+// checkKey returns an error wrapping ErrKeyRejected if the prefix index
+// doesn't accept the string form of a key.
+func (hm *HashTable[K, V]) checkKey(skey string) error {
+	if !hm.tree.Accepts(skey) {
+		return fmt.Errorf("key %q: %w", skey, ErrKeyRejected)
+	}
+	return nil
+}
+
+// set stores e, replacing the value of an existing entry for its key, and
+// returns the index of the bucket holding it and whether the key existed.
+// e gets the next revision as its version, unless it has one already. The
+// caller must hold the write lock.
+func (hm *HashTable[K, V]) set(e entry[K, V]) (uint64, bool) {
+	hm.rehashStep()
+
+	if hm.expiring() {
+		// An expired entry is replaced like a missing one.
+		hm.expire(e.skey)
+	}
+	hm.makeRoom(e.skey)
+
+	// New keys always go to the newest table.
+	target := hm.buckets
+	if hm.next != nil {
+		target = hm.next
+	}
+	index := target.getIndex(e.hash)
+
+	// Claim the key in the trie first, if it is already there the stored
+	// location tells which bucket holds the entry to update.
+	stored, loaded := hm.tree.LoadOrStore(e.skey, target.location(index))
+	index, updated := hm.place(e, target, index, stored, loaded)
+	if !updated {
+		hm.maybeResize()
+	}
+	return index, updated
+}
+
+// place stores e after its key was claimed in the trie, which holds the
+// location stored for it, and loaded tells whether it held one before.
+// New entries go to index of target. place returns the index of the bucket
+// holding the entry and whether it existed. It doesn't resize the table.
+// The caller must hold the write lock.
+func (hm *HashTable[K, V]) place(e entry[K, V], target *table[K, V], index uint64, stored interface{}, loaded bool) (uint64, bool) {
+	if e.version == 0 {
+		hm.revision++
+		e.version = hm.revision
+	} else if e.version > hm.revision {
+		hm.revision = e.version
+	}
+
+	if loaded {
+		t, storedIndex := hm.locate(stored)
+		if old := t.lookup(storedIndex, e.skey); old != nil {
+			hm.indexRemove(old)
+			prev := old.value
+			hm.trackExpiry(e.skey, old.expires, e.expires)
+			old.value, old.version, old.expires = e.value, e.version, e.expires
+			hm.indexAdd(old)
+			hm.cacheTouch(e.skey)
+			hm.notify(EventUpdate, old, prev)
+			return storedIndex, true
+		}
+	}
+
+	index = hm.insert(e, target, index)
+	hm.notify(EventSet, &e, *new(V))
+	return index, false
+}
+
+// insert adds e, whose key was claimed in the trie, as a new entry at
+// index of target without telling the watchers, and returns the index of
+// the bucket holding it. The caller must hold the write lock.
+func (hm *HashTable[K, V]) insert(e entry[K, V], target *table[K, V], index uint64) uint64 {
+	// open addressing may place it away from its home index.
+	if placed := target.insert(e, hm.moved(target)); placed != index {
+		index = placed
+		hm.tree.Insert(e.skey, target.location(index))
+	}
+	hm.indexAdd(&e)
+	hm.trackExpiry(e.skey, 0, e.expires)
+	hm.cacheAdd(e.skey)
+	hm.count++
+	return index
+}
+
+// GetAllKeys returns all keys stored in the trie.
+func (hm *HashTable[K, V]) GetAllKeys() []string {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	return hm.liveKeys(hm.tree.GetAllKeys())
+}
+
+// liveKeys drops the keys of expired entries from keys. The caller must
+// hold the lock.
+func (hm *HashTable[K, V]) liveKeys(keys []string) []string {
+	if !hm.expiring() {
+		return keys
+	}
+	live := keys[:0]
+	for _, key := range keys {
+		if hm.findEntry(key) != nil {
+			live = append(live, key)
+		}
+	}
+	return live
+}
+
+// Get returns the value associated with a key in the hashTable,
+// and an boolean indicating whether the value exists or not.
+func (hm *HashTable[K, V]) Get(key K) (V, bool) {
+	e, found := hm.getEntry(hm.keyString(key))
+	return e.value, found
+}
+
+// getEntry returns the entry stored for the string form of a key. An
+// expired entry is removed on the way.
+func (hm *HashTable[K, V]) getEntry(skey string) (entry[K, V], bool) {
+	hm.lock.RLock()
+	e := hm.lookupEntry(skey)
+	if e != nil && !hm.expired(e) {
+		found := *e
+		hm.lookedUp(skey, true)
+		hm.lock.RUnlock()
+		return found, true
+	}
+	hm.lookedUp(skey, false)
+	hm.lock.RUnlock()
+
+	if e != nil {
+		hm.lock.Lock()
+		hm.expire(skey)
+		hm.lock.Unlock()
+	}
+	return entry[K, V]{}, false
+}
+
+// findEntry returns the entry stored for the string form of a key, or nil
+// if there is none or it has expired. The caller must hold the lock.
+func (hm *HashTable[K, V]) findEntry(skey string) *entry[K, V] {
+	if e := hm.lookupEntry(skey); e != nil && !hm.expired(e) {
+		return e
+	}
+	return nil
+}
+
+// lookupEntry returns the entry stored for the string form of a key, or
+// nil, expired or not. The caller must hold the lock.
+func (hm *HashTable[K, V]) lookupEntry(skey string) *entry[K, V] {
+	val, found := hm.tree.Search(skey)
+	if !found || val == nil {
+		return nil
+	}
+	t, index := hm.locate(*val)
+	return t.lookup(index, skey)
+}
+
+// Delete deletes the entry associated with a key in the hashTable,
+// and an boolean indicating whether the it was successfully deleted
+// or not.
+func (hm *HashTable[K, V]) Delete(key K) (deleted bool) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	return hm.delete(hm.keyString(key))
+}
+
+// delete deletes the entry stored for the string form of a key. An
+// expired entry is removed too, but doesn't count as deleted. The caller
+// must hold the write lock.
+func (hm *HashTable[K, V]) delete(skey string) bool {
+	return hm.remove(skey, EventDelete) == EventDelete
+}
+
+// remove removes the entry stored for the string form of a key, telling
+// the watchers it is removed for the given reason, and returns the reason
+// it reported; EventExpire if the entry had expired, 0 if there was none.
+// The caller must hold the write lock.
+func (hm *HashTable[K, V]) remove(skey string, reason EventKind) EventKind {
+	e, ok := hm.detach(skey)
+	if !ok {
+		return 0
+	}
+	if hm.expired(&e) {
+		reason = EventExpire
+	}
+	hm.notify(reason, &e, e.value)
+	hm.maybeResize()
+	return reason
+}
+
+// detach takes the entry stored for the string form of a key out of the
+// trie, the buckets, the indexes and the eviction policy without telling
+// the watchers, and returns it. It doesn't resize the table. The caller
+// must hold the write lock.
+func (hm *HashTable[K, V]) detach(skey string) (entry[K, V], bool) {
+	hm.rehashStep()
+
+	ind, deleted := hm.tree.Delete(skey)
+	if !deleted || *ind == nil {
+		return entry[K, V]{}, false
+	}
+	t, index := hm.locate(*ind)
+	e := t.lookup(index, skey)
+	if e == nil {
+		return entry[K, V]{}, false
+	}
+	detached := *e
+	hm.indexRemove(e)
+	hm.trackExpiry(skey, e.expires, 0)
+	hm.cacheRemove(skey)
+	if !t.remove(index, skey, hm.moved(t)) {
+		return entry[K, V]{}, false
+	}
+	hm.count--
+	return detached, true
+}
+
+// GetKeysWithPrefix returns all keys exiting with a given prefix
+func (hm *HashTable[K, V]) GetKeysWithPrefix(prefix string) []string {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	keys := hm.tree.GetPrefixKeys(prefix)
+	return hm.liveKeys(keys)
+}
+
+// GetPairsWithPrefix returns all key value pairs whose key starts with
+// the given prefix, ordered by key.
+func (hm *HashTable[K, V]) GetPairsWithPrefix(pref string) []Pair[K, V] {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	pairs := make([]Pair[K, V], 0)
+	if len(pref) == 0 {
+		return pairs
+	}
+	return hm.appendPairs(pairs, pref)
+}
+
+// GetAllPairs returns all key value pairs ordered by key.
+func (hm *HashTable[K, V]) GetAllPairs() []Pair[K, V] {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	return hm.appendPairs(make([]Pair[K, V], 0, hm.count), "")
+}
+
+// appendPairs appends the pairs whose key starts with prefix to pairs in
+// key order, resolving each entry from the location the walk yields. The
+// caller must hold the lock.
+func (hm *HashTable[K, V]) appendPairs(pairs []Pair[K, V], prefix string) []Pair[K, V] {
+	hm.walk(prefix, func(e *entry[K, V]) bool {
+		pairs = append(pairs, Pair[K, V]{e.key, e.value})
+		return true
+	})
+	return pairs
+}
+
+// walk calls fn for the entries whose key starts with prefix in key order,
+// until fn returns false. The caller must hold the lock.
+func (hm *HashTable[K, V]) walk(prefix string, fn func(e *entry[K, V]) bool) {
+	hm.tree.Walk(prefix, func(skey string, location interface{}) bool {
+		t, index := hm.locate(location)
+		if e := t.lookup(index, skey); e != nil && !hm.expired(e) {
+			return fn(e)
+		}
+		return true
+	})
+}
@@ -0,0 +1,81 @@
+package generic
+
+import (
+	"github.com/matinhimself/trie/pkg/hashtable/internal/hooks"
+	"time"
+)
+
+// tableHooks holds the methods package storage reaches through Hooks.
+// prepare, unless nil, is called with the table locked once a change is
+// checked and before it is applied, so it must not use the table. If it
+// fails, nothing changes and its error is returned.
+type tableHooks[K comparable, V any] struct {
+	hm *HashTable[K, V]
+}
+
+// Hooks returns the hooks package storage logs the changes of the table
+// with. It takes a hooks.Seal, which only the packages of this module can
+// make.
+func (hm *HashTable[K, V]) Hooks(hooks.Seal) interface{} {
+	return tableHooks[K, V]{hm}
+}
+
+// Set is HashTable.Set calling prepare once the key is checked.
+func (h tableHooks[K, V]) Set(key K, value V, prepare func() error) (uint64, error) {
+	return h.hm.setExpiring(key, value, 0, prepare)
+}
+
+// SetUntil is HashTable.SetUntil calling prepare once the key is checked.
+func (h tableHooks[K, V]) SetUntil(key K, value V, deadline time.Time, prepare func() error) (uint64, error) {
+	return h.hm.setExpiring(key, value, expiresAt(deadline), prepare)
+}
+
+// Update is HashTable.Update calling prepare with the changes of the
+// transaction once they are checked.
+func (h tableHooks[K, V]) Update(fn func(tx *Tx[K, V]) error, prepare func(changes []Change[K, V]) error) error {
+	return h.hm.update(fn, prepare)
+}
+
+// CompareAndSet is HashTable.CompareAndSet calling prepare once the
+// version is checked.
+func (h tableHooks[K, V]) CompareAndSet(key K, value V, expected uint64, prepare func() error) (uint64, error) {
+	return h.hm.compareAndSet(key, value, expected, prepare)
+}
+
+// CompareAndDelete is HashTable.CompareAndDelete calling prepare once the
+// version is checked.
+func (h tableHooks[K, V]) CompareAndDelete(key K, expected uint64, prepare func() error) error {
+	return h.hm.compareAndDelete(key, expected, prepare)
+}
+
+// BulkSet is HashTable.LoadSorted if sorted is set, HashTable.SetMany
+// otherwise, calling prepare with the pairs that will be set once they
+// are checked.
+func (h tableHooks[K, V]) BulkSet(pairs []Pair[K, V], sorted bool, prepare func(accepted []Pair[K, V]) error) ([]SetResult, error) {
+	return h.hm.bulkSet(pairs, sorted, prepare)
+}
+
+// Rekey is HashTable.Rekey calling prepare once the move is checked.
+func (h tableHooks[K, V]) Rekey(oldKey, newKey K, value V, prepare func() error) (uint64, error) {
+	return h.hm.rekey(oldKey, newKey, value, prepare)
+}
+
+// OnEvict makes a table with a capacity call fn, unless it is nil, with
+// the key of every entry it evicts, after the eviction and with the table
+// locked.
+func (h tableHooks[K, V]) OnEvict(fn func(K)) {
+	h.hm.onEvict(fn)
+}
+
+// SuspendEviction lets a table with a capacity hold more entries than its
+// capacity while suspend is set. Resuming evicts entries until the table
+// is within its capacity again.
+func (h tableHooks[K, V]) SuspendEviction(suspend bool) {
+	h.hm.suspendEviction(suspend)
+}
+
+// Contains reports whether the table holds a key, without counting it as
+// a lookup or marking it as used like Get does.
+func (h tableHooks[K, V]) Contains(key K) bool {
+	return h.hm.contains(key)
+}
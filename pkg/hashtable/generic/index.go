@@ -0,0 +1,164 @@
+package generic
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/trie"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// secondaryIndex maps the terms extract returns for the stored values to
+// the keys of those values. The terms are kept in a ternary tree, so they
+// can be searched by prefix.
+type secondaryIndex[V any] struct {
+	extract func(V) []string
+	// terms maps each term to the set of string keys having it, as a
+	// map[string]struct{}.
+	terms *trie.TernaryTree
+	// byKey holds the terms each key was indexed under. Values may be
+	// changed in place before they are set again, so the old terms can't
+	// be extracted from them any more.
+	byKey map[string][]string
+}
+
+func newSecondaryIndex[V any](extract func(V) []string) *secondaryIndex[V] {
+	return &secondaryIndex[V]{
+		extract: extract,
+		terms:   trie.NewTernaryTree(),
+		byKey:   make(map[string][]string),
+	}
+}
+
+// add indexes value under the string key skey.
+func (ix *secondaryIndex[V]) add(skey string, value V) {
+	terms := ix.extract(value)
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		keys, _ := ix.terms.LoadOrStore(term, map[string]struct{}{})
+		keys.(map[string]struct{})[skey] = struct{}{}
+	}
+	if len(terms) > 0 {
+		ix.byKey[skey] = append([]string(nil), terms...)
+	}
+}
+
+// remove drops the string key skey from the index.
+func (ix *secondaryIndex[V]) remove(skey string) {
+	for _, term := range ix.byKey[skey] {
+		if term == "" {
+			continue
+		}
+		val, found := ix.terms.Search(term)
+		if !found {
+			continue
+		}
+		keys := (*val).(map[string]struct{})
+		delete(keys, skey)
+		if len(keys) == 0 {
+			ix.terms.Delete(term)
+		}
+	}
+	delete(ix.byKey, skey)
+}
+
+// keys returns the string keys indexed under term, or under any term
+// starting with term if prefix is set, in key order.
+func (ix *secondaryIndex[V]) keys(term string, prefix bool) []string {
+	if term == "" {
+		return nil
+	}
+	if prefix {
+		return ix.keysMatching(term, nil)
+	}
+	val, found := ix.terms.Search(term)
+	if !found {
+		return nil
+	}
+	return sortedKeys((*val).(map[string]struct{}))
+}
+
+// keysMatching returns the string keys indexed under a term starting with
+// prefix that match accepts, in key order. A nil match accepts all terms.
+func (ix *secondaryIndex[V]) keysMatching(prefix string, match func(term string) bool) []string {
+	set := make(map[string]struct{})
+	ix.terms.Walk(prefix, func(term string, value interface{}) bool {
+		if match == nil || match(term) {
+			for skey := range value.(map[string]struct{}) {
+				set[skey] = struct{}{}
+			}
+		}
+		return true
+	})
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for skey := range set {
+		keys = append(keys, skey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Tokens splits s into lower case words, for indexing names and other
+// free text with WithIndex.
+func Tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// indexAdd adds an entry to every secondary index. The caller must hold
+// the write lock.
+func (hm *HashTable[K, V]) indexAdd(e *entry[K, V]) {
+	for _, ix := range hm.indexes {
+		ix.add(e.skey, e.value)
+	}
+	for _, ix := range hm.ordered {
+		ix.add(e.skey, e.value)
+	}
+}
+
+// indexRemove removes an entry from every secondary index. The caller
+// must hold the write lock.
+func (hm *HashTable[K, V]) indexRemove(e *entry[K, V]) {
+	for _, ix := range hm.indexes {
+		ix.remove(e.skey)
+	}
+	for _, ix := range hm.ordered {
+		ix.remove(e.skey)
+	}
+}
+
+// GetByIndex returns the pairs whose value has the given term in the
+// secondary index name, ordered by key.
+func (hm *HashTable[K, V]) GetByIndex(name, term string) ([]Pair[K, V], error) {
+	return hm.getByIndex(name, term, false)
+}
+
+// GetByIndexPrefix returns the pairs whose value has a term starting with
+// prefix in the secondary index name, ordered by key.
+func (hm *HashTable[K, V]) GetByIndexPrefix(name, prefix string) ([]Pair[K, V], error) {
+	return hm.getByIndex(name, prefix, true)
+}
+
+func (hm *HashTable[K, V]) getByIndex(name, term string, prefix bool) ([]Pair[K, V], error) {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	ix, ok := hm.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("no index named %q", name)
+	}
+	pairs := make([]Pair[K, V], 0)
+	for _, skey := range ix.keys(term, prefix) {
+		if e := hm.findEntry(skey); e != nil {
+			pairs = append(pairs, Pair[K, V]{e.key, e.value})
+		}
+	}
+	return pairs, nil
+}
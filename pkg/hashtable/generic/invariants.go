@@ -0,0 +1,69 @@
+package generic
+
+import "fmt"
+
+// CheckInvariants checks that the prefix index and the buckets agree:
+// both hold as many keys as the table counts, every key of the index
+// locates the entry of that key, and every entry is located by its key.
+// It also checks the bookkeeping of expiry and capacity. It returns an
+// error describing the first violation found, for tests and debugging.
+func (hm *HashTable[K, V]) CheckInvariants() error {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	if n := hm.tree.Size(); n != hm.count {
+		return fmt.Errorf("prefix index holds %d keys, table counts %d entries", n, hm.count)
+	}
+	if n := hm.buckets.size(); n != hm.size {
+		return fmt.Errorf("table has %d buckets, its size is %d", n, hm.size)
+	}
+
+	keys := 0
+	var err error
+	hm.tree.Walk("", func(skey string, location interface{}) bool {
+		keys++
+		t, index := hm.locate(location)
+		if index >= uint64(t.size()) || t.lookup(index, skey) == nil {
+			err = fmt.Errorf("key %s: no entry at bucket %d of generation %d", skey, index, t.generation)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if keys != hm.count {
+		return fmt.Errorf("prefix index walks %d keys, table counts %d entries", keys, hm.count)
+	}
+
+	entries, expiring := 0, 0
+	for _, t := range hm.tables() {
+		for i := 0; i < t.size(); i++ {
+			for _, e := range t.chain(uint64(i)) {
+				entries++
+				if e.expires != 0 {
+					expiring++
+				}
+				location, found := hm.tree.Search(e.skey)
+				if !found || *location != interface{}(t.location(uint64(i))) {
+					return fmt.Errorf("key %s: entry at bucket %d of generation %d isn't located by the prefix index", e.skey, i, t.generation)
+				}
+			}
+		}
+	}
+	if entries != hm.count {
+		return fmt.Errorf("buckets hold %d entries, table counts %d", entries, hm.count)
+	}
+
+	tracked := 0
+	if hm.expiry != nil {
+		tracked = hm.expiry.length
+	}
+	if tracked != expiring {
+		return fmt.Errorf("%d entries expire, %d expiries are tracked", expiring, tracked)
+	}
+	if hm.cache != nil && hm.count > hm.cache.capacity {
+		return fmt.Errorf("table holds %d entries, its capacity is %d", hm.count, hm.cache.capacity)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package generic
+
+import (
+	"github.com/matinhimself/trie/pkg/trie"
+	"time"
+)
+
+// config holds the settings a HashTable is constructed with.
+type config struct {
+	newIndex         func() trie.PrefixIndex
+	minLoad, maxLoad float64
+	openAddressing   bool
+	// hashValue and keyString hold typed functions, they are checked
+	// against the table's type parameters by NewHashTable.
+	hashValue interface{}
+	keyString interface{}
+	hasher    Hasher
+	seed      uint64
+	// watchBuffer is the channel capacity of every watcher.
+	watchBuffer int
+	now         func() time.Time
+	janitor     time.Duration
+	capacity    int
+	newPolicy   func() EvictionPolicy
+	// onEvict holds a typed callback like hashValue.
+	onEvict interface{}
+	// indexes and ordered map index names to typed extractors.
+	indexes map[string]interface{}
+	ordered map[string]interface{}
+}
+
+func defaultConfig() config {
+	return config{
+		newIndex:    func() trie.PrefixIndex { return trie.NewTernaryTree() },
+		watchBuffer: defaultWatchBuffer,
+		now:         time.Now,
+	}
+}
+
+// Option configures a HashTable in NewHashTable.
+type Option func(*config)
+
+// WithPrefixIndex makes the hashtable store its keys in the index returned
+// by newIndex instead of the default ternary search tree, which takes any
+// non-empty key, e.g. in the more compact digit trie for decimal keys:
+//
+//	generic.NewHashTable[K, V](1000, hash, generic.WithPrefixIndex(func() trie.PrefixIndex {
+//		return trie.NewTrie()
+//	}))
+func WithPrefixIndex(newIndex func() trie.PrefixIndex) Option {
+	return func(c *config) {
+		c.newIndex = newIndex
+	}
+}
+
+// WithAutoResize makes the hashtable double its buckets when the average
+// chain length exceeds maxLoad and halve them when it drops below minLoad,
+// but never below the size it was created with. Keys are migrated a few
+// buckets at a time on every write, so no single call pays for a full
+// rehash.
+func WithAutoResize(minLoad, maxLoad float64) Option {
+	return func(c *config) {
+		c.minLoad, c.maxLoad = minLoad, maxLoad
+	}
+}
+
+// WithOpenAddressing stores the nodes in a flat slot array using Robin
+// Hood hashing with backward shift deletion instead of a chain per
+// bucket. The size passed to NewHashTable is then the number of slots.
+// The table grows before more than 90% of the slots are in use, even
+// without WithAutoResize.
+func WithOpenAddressing() Option {
+	return func(c *config) {
+		c.openAddressing = true
+	}
+}
+
+// WithValueHash makes the hashtable place entries by the hash of their
+// value instead of their key, for values that know how to hash
+// themselves. V has to be the value type of the table.
+func WithValueHash[V any](hash func(V) uint64) Option {
+	return func(c *config) {
+		c.hashValue = hash
+	}
+}
+
+// WithHasher makes the hashtable place entries by hashing the string form
+// of their keys with h, whatever the key and value types are. It takes
+// precedence over the hash function passed to NewHashTable and over
+// WithValueHash.
+func WithHasher(h Hasher) Option {
+	return func(c *config) {
+		c.hasher = h
+	}
+}
+
+// WithSeed sets the seed passed to the Hasher of the table. Tables with
+// the same Hasher and seed place keys identically in every process, and a
+// snapshot written by one of them loads into another without rehashing.
+// It has no effect without WithHasher.
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// WithIndex adds a secondary index called name. extract returns the
+// terms a value is found by, e.g. its discipline or the Tokens of its
+// name; GetByIndex and GetByIndexPrefix then look values up by term. The
+// index follows every Set and Delete. V has to be the value type of the
+// table.
+func WithIndex[V any](name string, extract func(V) []string) Option {
+	return func(c *config) {
+		if c.indexes == nil {
+			c.indexes = make(map[string]interface{})
+		}
+		c.indexes[name] = extract
+	}
+}
+
+// WithOrderedIndex adds an index called name that orders the values by
+// the score extract returns for them, e.g. a GPA. Range, TopK, Rank and
+// Percentile query it. Values scoring NaN are not indexed. V has to be the
+// value type of the table.
+func WithOrderedIndex[V any](name string, score func(V) float64) Option {
+	return func(c *config) {
+		if c.ordered == nil {
+			c.ordered = make(map[string]interface{})
+		}
+		c.ordered[name] = score
+	}
+}
+
+// WithKeyString sets how keys are turned into the strings stored in the
+// prefix index. Different keys must have different strings. By default
+// string keys are used as they are and other keys are formatted with
+// fmt.Sprint. K has to be the key type of the table.
+func WithKeyString[K comparable](keyString func(K) string) Option {
+	return func(c *config) {
+		c.keyString = keyString
+	}
+}
+
+// WithWatchBuffer sets how many events a watcher may fall behind by
+// before it is dropped, see HashTable.Watch. It defaults to 256.
+func WithWatchBuffer(n int) Option {
+	return func(c *config) {
+		c.watchBuffer = n
+	}
+}
+
+// WithClock makes the table read the time from now instead of time.Now
+// when it sets and checks the expiry of entries, e.g. to control it in
+// tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+// WithJanitor starts a goroutine that removes the expired entries every
+// interval, until the table is closed by Close. Without it they are only
+// removed when their keys are accessed, or by ExpireNow.
+func WithJanitor(interval time.Duration) Option {
+	return func(c *config) {
+		c.janitor = interval
+	}
+}
+
+// WithCapacity bounds the table to capacity entries. Setting a new key
+// in a full table first evicts the key picked by the policy newPolicy
+// returns, e.g. NewLRU, NewLFU or NewClock; LRU if it is nil. Get,
+// GetVersioned and ExpiresAt count as uses of a key, see CacheStats. A
+// ShardedHashTable bounds every shard to capacity.
+//
+// A storage.Store logs the evictions of its table as deletes, so replaying
+// its log evicts nothing and restores the same entries.
+func WithCapacity(capacity int, newPolicy func() EvictionPolicy) Option {
+	return func(c *config) {
+		c.capacity, c.newPolicy = capacity, newPolicy
+	}
+}
+
+// WithEvictionCallback makes the table call onEvict with every entry it
+// evicts to make room, see WithCapacity. It is called with the table
+// locked and must not use the table.
+func WithEvictionCallback[K comparable, V any](onEvict func(K, V)) Option {
+	return func(c *config) {
+		c.onEvict = onEvict
+	}
+}
@@ -0,0 +1,162 @@
+package generic
+
+import (
+	"fmt"
+	"math"
+)
+
+// orderedIndex keeps the keys of the stored values ordered by the score
+// extract returns for them, ties ordered by key.
+type orderedIndex[V any] struct {
+	score func(V) float64
+	list  *skipList
+	// byKey holds the score each key was indexed with, see
+	// secondaryIndex.byKey.
+	byKey map[string]float64
+}
+
+func newOrderedIndex[V any](score func(V) float64) *orderedIndex[V] {
+	return &orderedIndex[V]{score: score, list: newSkipList(), byKey: make(map[string]float64)}
+}
+
+// add indexes value under the string key skey. Values scoring NaN are
+// left out, they have no place in the order.
+func (ix *orderedIndex[V]) add(skey string, value V) {
+	score := ix.score(value)
+	if math.IsNaN(score) {
+		return
+	}
+	ix.list.insert(score, skey)
+	ix.byKey[skey] = score
+}
+
+// remove drops the string key skey from the index.
+func (ix *orderedIndex[V]) remove(skey string) {
+	if score, ok := ix.byKey[skey]; ok {
+		ix.list.remove(score, skey)
+		delete(ix.byKey, skey)
+	}
+}
+
+// orderedIndex returns the ordered index name. The caller must hold the
+// lock.
+func (hm *HashTable[K, V]) orderedIndex(name string) (*orderedIndex[V], error) {
+	ix, ok := hm.ordered[name]
+	if !ok {
+		return nil, fmt.Errorf("no ordered index named %q", name)
+	}
+	return ix, nil
+}
+
+// rlockLive read-locks the table for a read of the ordered indexes. Expired
+// entries still in the indexes are removed first, under the write lock as
+// getEntry does, so the ranks and counts of the indexes are those of the
+// live entries.
+func (hm *HashTable[K, V]) rlockLive() {
+	hm.lock.RLock()
+	if hm.expiredCount() == 0 {
+		return
+	}
+	hm.lock.RUnlock()
+	hm.ExpireNow()
+	hm.lock.RLock()
+}
+
+// appendNode appends the pair of the key of n to pairs. The caller must
+// hold the lock.
+func (hm *HashTable[K, V]) appendNode(pairs []Pair[K, V], n *slNode) []Pair[K, V] {
+	if e := hm.findEntry(n.key); e != nil {
+		pairs = append(pairs, Pair[K, V]{e.key, e.value})
+	}
+	return pairs
+}
+
+// Range returns the pairs scoring between min and max, both included, in
+// the ordered index name, in ascending order of score.
+func (hm *HashTable[K, V]) Range(name string, min, max float64) ([]Pair[K, V], error) {
+	hm.rlockLive()
+	defer hm.lock.RUnlock()
+
+	ix, err := hm.orderedIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]Pair[K, V], 0)
+	for n := ix.list.seek(min); n != nil && n.score <= max; n = n.next[0].node {
+		pairs = hm.appendNode(pairs, n)
+	}
+	return pairs, nil
+}
+
+// TopK returns the k highest scoring pairs in the ordered index name, in
+// descending order of score.
+func (hm *HashTable[K, V]) TopK(name string, k int) ([]Pair[K, V], error) {
+	hm.rlockLive()
+	defer hm.lock.RUnlock()
+
+	ix, err := hm.orderedIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if k > ix.list.length {
+		k = ix.list.length
+	}
+	pairs := make([]Pair[K, V], 0, k)
+	if k <= 0 {
+		return pairs, nil
+	}
+	for n := ix.list.byRank(ix.list.length - k + 1); n != nil; n = n.next[0].node {
+		pairs = hm.appendNode(pairs, n)
+	}
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return pairs, nil
+}
+
+// Rank returns the position of key in the ordered index name counted
+// from the lowest score, starting at 0, and whether the key is indexed.
+func (hm *HashTable[K, V]) Rank(name string, key K) (int, bool, error) {
+	hm.rlockLive()
+	defer hm.lock.RUnlock()
+
+	ix, err := hm.orderedIndex(name)
+	if err != nil {
+		return 0, false, err
+	}
+	skey := hm.keyString(key)
+	score, ok := ix.byKey[skey]
+	if !ok {
+		return 0, false, nil
+	}
+	return ix.list.rank(score, skey) - 1, true, nil
+}
+
+// Percentile returns the pair at the p-th percentile, 0 <= p <= 100, of
+// the ordered index name by the nearest rank method: the lowest scoring
+// pair that scores at least as high as p percent of all pairs. It reports
+// false if the index is empty.
+func (hm *HashTable[K, V]) Percentile(name string, p float64) (Pair[K, V], bool, error) {
+	hm.rlockLive()
+	defer hm.lock.RUnlock()
+
+	ix, err := hm.orderedIndex(name)
+	if err != nil {
+		return Pair[K, V]{}, false, err
+	}
+	if p < 0 || p > 100 || math.IsNaN(p) {
+		return Pair[K, V]{}, false, fmt.Errorf("percentile %v is out of [0, 100]", p)
+	}
+	if ix.list.length == 0 {
+		return Pair[K, V]{}, false, nil
+	}
+	rank := int(math.Ceil(p / 100 * float64(ix.list.length)))
+	if rank < 1 {
+		rank = 1
+	}
+	pairs := hm.appendNode(nil, ix.list.byRank(rank))
+	if len(pairs) == 0 {
+		return Pair[K, V]{}, false, nil
+	}
+	return pairs[0], true, nil
+}
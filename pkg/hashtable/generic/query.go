@@ -0,0 +1,560 @@
+package generic
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// condOp is the comparison a Cond makes.
+type condOp int
+
+const (
+	condEq condOp = iota
+	condPrefix
+	condContains
+	condBetween
+)
+
+// Cond is a condition on a field of the values, for Query.Where. A field
+// is an index the table was created with: Eq, HasPrefix and Contains
+// compare the terms of a WithIndex index, Between the scores of a
+// WithOrderedIndex index.
+type Cond struct {
+	field    string
+	op       condOp
+	term     string
+	min, max float64
+}
+
+// Eq matches values having term in field.
+func Eq(field, term string) Cond {
+	return Cond{field: field, op: condEq, term: term}
+}
+
+// HasPrefix matches values having a term starting with prefix in field.
+func HasPrefix(field, prefix string) Cond {
+	return Cond{field: field, op: condPrefix, term: prefix}
+}
+
+// Contains matches values having a term containing substr in field.
+func Contains(field, substr string) Cond {
+	return Cond{field: field, op: condContains, term: substr}
+}
+
+// Between matches values scoring between min and max, both included, in
+// field.
+func Between(field string, min, max float64) Cond {
+	return Cond{field: field, op: condBetween, min: min, max: max}
+}
+
+func (c Cond) String() string {
+	switch c.op {
+	case condEq:
+		return fmt.Sprintf("%s = %q", c.field, c.term)
+	case condPrefix:
+		return fmt.Sprintf("%s has prefix %q", c.field, c.term)
+	case condContains:
+		return fmt.Sprintf("%s contains %q", c.field, c.term)
+	default:
+		return fmt.Sprintf("%s in [%v, %v]", c.field, c.min, c.max)
+	}
+}
+
+// Query selects, orders and pages the pairs of a HashTable. It is built
+// by chaining its methods on HashTable.Query and run by Run, e.g.
+//
+//	hm.Query().Where(generic.Eq("discipline", "CE")).OrderBy("gpa", true).Limit(10).Run()
+//
+// A planner picks how to find the candidates: through the most selective
+// index condition, an ordered index scan when the result is ordered by
+// that index, or a walk over the keys in the prefix index. Every
+// condition is checked on every candidate.
+type Query[K comparable, V any] struct {
+	hm *HashTable[K, V]
+
+	keyPrefix      string
+	keyFrom, keyTo string
+	keyRange       bool
+	conds          []Cond
+	filters        []func(K, V) bool
+
+	// order is the field the pairs are ordered by, the key if empty.
+	order     string
+	orderDesc bool
+	orderLess func(a, b Pair[K, V]) bool
+
+	offset int
+	// limit is the maximum number of pairs returned, negative for none.
+	limit int
+}
+
+// Query returns a query over all pairs of the table, ordered by key.
+func (hm *HashTable[K, V]) Query() *Query[K, V] {
+	return &Query[K, V]{hm: hm, limit: -1}
+}
+
+// KeyPrefix restricts the query to keys starting with prefix. Unless
+// empty, prefix has to be accepted by the prefix index, see
+// trie.PrefixIndex.Accepts.
+func (q *Query[K, V]) KeyPrefix(prefix string) *Query[K, V] {
+	q.keyPrefix = prefix
+	return q
+}
+
+// KeyRange restricts the query to keys between from and to in
+// lexicographic order, both included. Like the prefix of KeyPrefix, from
+// and to have to be accepted by the prefix index unless empty.
+func (q *Query[K, V]) KeyRange(from, to string) *Query[K, V] {
+	q.keyFrom, q.keyTo, q.keyRange = from, to, true
+	return q
+}
+
+// Where restricts the query to values meeting all conds.
+func (q *Query[K, V]) Where(conds ...Cond) *Query[K, V] {
+	q.conds = append(q.conds, conds...)
+	return q
+}
+
+// Filter restricts the query to pairs fn returns true for. Filters can't
+// use an index, they are checked on the candidates the plan yields.
+func (q *Query[K, V]) Filter(fn func(key K, value V) bool) *Query[K, V] {
+	q.filters = append(q.filters, fn)
+	return q
+}
+
+// OrderBy orders the result by field, by score for an ordered index and
+// by the first term for a term index. Ties are ordered by key. desc
+// reverses the order.
+func (q *Query[K, V]) OrderBy(field string, desc bool) *Query[K, V] {
+	q.order, q.orderDesc, q.orderLess = field, desc, nil
+	return q
+}
+
+// OrderByKey orders the result by key, which is the default.
+func (q *Query[K, V]) OrderByKey(desc bool) *Query[K, V] {
+	return q.OrderBy("", desc)
+}
+
+// OrderByFunc orders the result by less. It replaces OrderBy.
+func (q *Query[K, V]) OrderByFunc(less func(a, b Pair[K, V]) bool) *Query[K, V] {
+	q.order, q.orderDesc, q.orderLess = "", false, less
+	return q
+}
+
+// Offset skips the first n pairs of the result. n must not be negative.
+func (q *Query[K, V]) Offset(n int) *Query[K, V] {
+	q.offset = n
+	return q
+}
+
+// Limit returns at most n pairs.
+func (q *Query[K, V]) Limit(n int) *Query[K, V] {
+	q.limit = n
+	return q
+}
+
+// Source kinds of a query plan.
+const (
+	// sourceWalk walks the keys of the prefix index under a prefix.
+	sourceWalk = iota
+	// sourceKeys visits the keys an index condition selected.
+	sourceKeys
+	// sourceOrdered scans an ordered index over a score range.
+	sourceOrdered
+)
+
+// queryPlan is how a query finds its candidates.
+type queryPlan[V any] struct {
+	source int
+	// prefix is the prefix walked by sourceWalk.
+	prefix string
+	// keys are the keys visited by sourceKeys, in key order.
+	keys []string
+	// ordered and min, max are the index and range of sourceOrdered.
+	ordered  *orderedIndex[V]
+	min, max float64
+	// streamed is set when the source yields the final order, so the
+	// query can stop once the limit is reached.
+	streamed bool
+	steps    []string
+}
+
+// check verifies that the fields of the query exist and are indexed as
+// the conditions require, and that its keys and offset are valid. The
+// caller must hold the lock.
+func (q *Query[K, V]) check() error {
+	if q.keyPrefix != "" && !q.hm.tree.Accepts(q.keyPrefix) {
+		return fmt.Errorf("key prefix %q: %w", q.keyPrefix, ErrKeyRejected)
+	}
+	if q.keyRange {
+		for _, bound := range []string{q.keyFrom, q.keyTo} {
+			if bound != "" && !q.hm.tree.Accepts(bound) {
+				return fmt.Errorf("key range bound %q: %w", bound, ErrKeyRejected)
+			}
+		}
+	}
+	if q.offset < 0 {
+		return fmt.Errorf("offset %d is negative", q.offset)
+	}
+	for _, c := range q.conds {
+		_, term := q.hm.indexes[c.field]
+		_, ordered := q.hm.ordered[c.field]
+		switch {
+		case !term && !ordered:
+			return fmt.Errorf("no index named %q", c.field)
+		case c.op == condBetween && !ordered:
+			return fmt.Errorf("%s: %q isn't an ordered index", c, c.field)
+		case c.op != condBetween && !term:
+			return fmt.Errorf("%s: %q isn't a term index", c, c.field)
+		}
+	}
+	if q.order != "" {
+		_, term := q.hm.indexes[q.order]
+		_, ordered := q.hm.ordered[q.order]
+		if !term && !ordered {
+			return fmt.Errorf("can't order by %q, there is no such index", q.order)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the value stored under skey meets c. It
+// compares the terms and scores recorded by the indexes. The caller must
+// hold the lock.
+func (q *Query[K, V]) matches(c Cond, skey string) bool {
+	if c.op == condBetween {
+		score, ok := q.hm.ordered[c.field].byKey[skey]
+		return ok && score >= c.min && score <= c.max
+	}
+	for _, term := range q.hm.indexes[c.field].byKey[skey] {
+		if c.matchTerm(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTerm reports whether a single term meets c.
+func (c Cond) matchTerm(term string) bool {
+	switch c.op {
+	case condEq:
+		return term == c.term
+	case condPrefix:
+		return strings.HasPrefix(term, c.term)
+	default:
+		return strings.Contains(term, c.term)
+	}
+}
+
+// selected returns the keys meeting an index condition in key order, or
+// only their number for a Between condition, which ranks can tell without
+// visiting them. The caller must hold the lock.
+func (q *Query[K, V]) selected(c Cond) (keys []string, count int) {
+	if c.op == condBetween {
+		list := q.hm.ordered[c.field].list
+		count = list.countBelow(c.max, true) - list.countBelow(c.min, false)
+		if count < 0 {
+			count = 0
+		}
+		return nil, count
+	}
+	ix := q.hm.indexes[c.field]
+	switch c.op {
+	case condEq:
+		keys = ix.keys(c.term, false)
+	case condPrefix:
+		keys = ix.keysMatching(c.term, nil)
+	default:
+		keys = ix.keysMatching("", c.matchTerm)
+	}
+	return keys, len(keys)
+}
+
+// plan picks the source of the candidates. The caller must hold the lock.
+func (q *Query[K, V]) plan() *queryPlan[V] {
+	p := &queryPlan[V]{}
+
+	best, bestCount := -1, 0
+	var bestKeys []string
+	for i, c := range q.conds {
+		keys, count := q.selected(c)
+		if best < 0 || count < bestCount {
+			best, bestCount, bestKeys = i, count, keys
+		}
+	}
+
+	var orderIx *orderedIndex[V]
+	if q.orderLess == nil && q.order != "" {
+		orderIx = q.hm.ordered[q.order]
+	}
+	direction := "ascending"
+	if q.orderDesc {
+		direction = "descending"
+	}
+
+	switch {
+	case best >= 0 && q.conds[best].op == condBetween && orderIx != nil && q.conds[best].field == q.order:
+		c := q.conds[best]
+		p.source, p.ordered, p.min, p.max, p.streamed = sourceOrdered, orderIx, c.min, c.max, true
+		p.steps = append(p.steps, fmt.Sprintf("scan ordered index %s [%v, %v] %s (%d keys)",
+			c.field, c.min, c.max, direction, bestCount))
+	// Values scoring NaN aren't in the ordered index, when there are any
+	// the result is sorted instead, which puts them last as in every other
+	// plan.
+	case best < 0 && orderIx != nil && q.keyPrefix == "" && !q.keyRange && len(orderIx.byKey) == q.hm.count:
+		p.source, p.ordered, p.streamed = sourceOrdered, orderIx, true
+		p.min, p.max = math.Inf(-1), math.Inf(1)
+		p.steps = append(p.steps, fmt.Sprintf("scan ordered index %s %s", q.order, direction))
+	case best >= 0:
+		c := q.conds[best]
+		if c.op == condBetween {
+			bestKeys = q.hm.ordered[c.field].list.keysBetween(c.min, c.max)
+			sort.Strings(bestKeys)
+		}
+		p.source, p.keys = sourceKeys, bestKeys
+		p.streamed = q.order == "" && q.orderLess == nil && !q.orderDesc
+		p.steps = append(p.steps, fmt.Sprintf("look up index %s (%d keys)", c, bestCount))
+	default:
+		p.source, p.prefix = sourceWalk, q.keyPrefix
+		if p.prefix == "" && q.keyRange {
+			p.prefix = commonPrefix(q.keyFrom, q.keyTo)
+		}
+		p.streamed = q.order == "" && q.orderLess == nil && !q.orderDesc
+		if p.prefix == "" {
+			p.steps = append(p.steps, "walk all keys")
+		} else {
+			p.steps = append(p.steps, fmt.Sprintf("walk keys with prefix %q", p.prefix))
+		}
+	}
+
+	var filters []string
+	if q.keyPrefix != "" && p.prefix != q.keyPrefix {
+		filters = append(filters, fmt.Sprintf("key has prefix %q", q.keyPrefix))
+	}
+	if q.keyRange {
+		filters = append(filters, fmt.Sprintf("key in [%q, %q]", q.keyFrom, q.keyTo))
+	}
+	for i, c := range q.conds {
+		if i != best {
+			filters = append(filters, c.String())
+		}
+	}
+	if len(q.filters) > 0 {
+		filters = append(filters, fmt.Sprintf("%d filter funcs", len(q.filters)))
+	}
+	if len(filters) > 0 {
+		p.steps = append(p.steps, "filter "+strings.Join(filters, ", "))
+	}
+	if !p.streamed {
+		switch {
+		case q.orderLess != nil:
+			p.steps = append(p.steps, "sort by func")
+		case q.order != "":
+			p.steps = append(p.steps, fmt.Sprintf("sort by %s %s", q.order, direction))
+		default:
+			p.steps = append(p.steps, fmt.Sprintf("sort by key %s", direction))
+		}
+	}
+	if q.offset > 0 {
+		p.steps = append(p.steps, fmt.Sprintf("skip %d", q.offset))
+	}
+	if q.limit >= 0 {
+		p.steps = append(p.steps, fmt.Sprintf("limit %d", q.limit))
+	}
+	return p
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// accept reports whether the entry meets every condition of the query.
+// The caller must hold the lock.
+func (q *Query[K, V]) accept(e *entry[K, V]) bool {
+	if !strings.HasPrefix(e.skey, q.keyPrefix) {
+		return false
+	}
+	if q.keyRange && (e.skey < q.keyFrom || e.skey > q.keyTo) {
+		return false
+	}
+	for _, c := range q.conds {
+		if !q.matches(c, e.skey) {
+			return false
+		}
+	}
+	for _, fn := range q.filters {
+		if !fn(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Explain returns the plan the query would run with, one step per line.
+func (q *Query[K, V]) Explain() (string, error) {
+	q.hm.lock.RLock()
+	defer q.hm.lock.RUnlock()
+
+	if err := q.check(); err != nil {
+		return "", err
+	}
+	return strings.Join(q.plan().steps, "\n"), nil
+}
+
+// Run runs the query and returns the selected pairs. It fails if the
+// query uses a missing index or a key the prefix index doesn't accept, or
+// has a negative offset.
+func (q *Query[K, V]) Run() ([]Pair[K, V], error) {
+	q.hm.lock.RLock()
+	defer q.hm.lock.RUnlock()
+
+	if err := q.check(); err != nil {
+		return nil, err
+	}
+	p := q.plan()
+
+	entries := make([]*entry[K, V], 0)
+	skipped := 0
+	// visit collects an accepted entry and reports whether the scan
+	// should go on.
+	visit := func(e *entry[K, V]) bool {
+		if !q.accept(e) {
+			return true
+		}
+		if p.streamed {
+			if skipped < q.offset {
+				skipped++
+				return true
+			}
+			if q.limit >= 0 && len(entries) >= q.limit {
+				return false
+			}
+		}
+		entries = append(entries, e)
+		return !p.streamed || q.limit < 0 || len(entries) < q.limit
+	}
+
+	switch p.source {
+	case sourceWalk:
+		q.hm.walk(p.prefix, func(e *entry[K, V]) bool {
+			if p.streamed && q.keyRange && e.skey > q.keyTo {
+				return false
+			}
+			return visit(e)
+		})
+	case sourceKeys:
+		for _, skey := range p.keys {
+			if e := q.hm.findEntry(skey); e != nil && !visit(e) {
+				break
+			}
+		}
+	case sourceOrdered:
+		list := p.ordered.list
+		if q.orderDesc {
+			low := list.countBelow(p.min, false) + 1
+			for rank := list.countBelow(p.max, true); rank >= low; rank-- {
+				if e := q.hm.findEntry(list.byRank(rank).key); e != nil && !visit(e) {
+					break
+				}
+			}
+		} else {
+			for n := list.seek(p.min); n != nil && n.score <= p.max; n = n.next[0].node {
+				if e := q.hm.findEntry(n.key); e != nil && !visit(e) {
+					break
+				}
+			}
+		}
+	}
+
+	if !p.streamed {
+		q.sort(entries)
+		entries = page(entries, q.offset, q.limit)
+	}
+	pairs := make([]Pair[K, V], len(entries))
+	for i, e := range entries {
+		pairs[i] = Pair[K, V]{e.key, e.value}
+	}
+	return pairs, nil
+}
+
+// sort orders entries as the query asks. The caller must hold the lock.
+func (q *Query[K, V]) sort(entries []*entry[K, V]) {
+	if q.orderLess != nil {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return q.orderLess(Pair[K, V]{entries[i].key, entries[i].value}, Pair[K, V]{entries[j].key, entries[j].value})
+		})
+		return
+	}
+
+	var less func(a, b string) bool
+	// unscored tells the keys that go last in either direction.
+	unscored := func(string) bool { return false }
+	if ix, ok := q.hm.ordered[q.order]; ok {
+		less = func(a, b string) bool {
+			sa, sb := ix.byKey[a], ix.byKey[b]
+			return sa < sb || sa == sb && a < b
+		}
+		unscored = func(skey string) bool {
+			_, ok := ix.byKey[skey]
+			return !ok
+		}
+	} else if ix, ok := q.hm.indexes[q.order]; ok {
+		first := func(skey string) string {
+			if terms := ix.byKey[skey]; len(terms) > 0 {
+				return terms[0]
+			}
+			return ""
+		}
+		less = func(a, b string) bool {
+			ta, tb := first(a), first(b)
+			return ta < tb || ta == tb && a < b
+		}
+	} else {
+		less = func(a, b string) bool { return a < b }
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].skey, entries[j].skey
+		if ua, ub := unscored(a), unscored(b); ua != ub {
+			// Unscored values go last.
+			return ub
+		}
+		if q.orderDesc {
+			a, b = b, a
+		}
+		return less(a, b)
+	})
+}
+
+// page returns the part of s after skipping offset items, at most limit
+// items long if limit isn't negative.
+func page[T any](s []T, offset, limit int) []T {
+	if offset > len(s) {
+		offset = len(s)
+	}
+	s = s[offset:]
+	if limit >= 0 && limit < len(s) {
+		s = s[:limit]
+	}
+	return s
+}
+
+// Project runs q and maps every selected pair with fn, e.g. to pick a few
+// fields of the values.
+func Project[K comparable, V any, T any](q *Query[K, V], fn func(key K, value V) T) ([]T, error) {
+	pairs, err := q.Run()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]T, len(pairs))
+	for i, p := range pairs {
+		res[i] = fn(p.Key, p.Value)
+	}
+	return res, nil
+}
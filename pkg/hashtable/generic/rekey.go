@@ -0,0 +1,83 @@
+package generic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned, wrapped with the key, by Rekey when the key to
+// move doesn't exist.
+var ErrNotFound = errors.New("key not found")
+
+// Rekey moves the entry of oldKey to newKey, setting its value, and
+// returns its new version. The entry leaves the trie, the buckets and the
+// indexes under the old key and enters them under the new one at once:
+// readers see it under exactly one of the keys, it gets a single version,
+// and watchers get a single EventRekey. Like Set, it drops any expiry.
+//
+// Rekey fails with an error wrapping ErrNotFound if oldKey doesn't exist,
+// with a *ConflictError at version 0 expected if newKey exists already,
+// and with an error if the prefix index doesn't accept newKey. Moving an
+// entry to its own key sets its value.
+func (hm *HashTable[K, V]) Rekey(oldKey, newKey K, value V) (uint64, error) {
+	return hm.rekey(oldKey, newKey, value, nil)
+}
+
+// rekey is Rekey calling prepare, unless it is nil, once the move is
+// checked and before the entry is moved. If prepare fails, nothing is
+// moved and its error is returned. prepare is called with the table
+// locked, so it must not use the table.
+func (hm *HashTable[K, V]) rekey(oldKey, newKey K, value V, prepare func() error) (uint64, error) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	oskey, nskey := hm.keyString(oldKey), hm.keyString(newKey)
+	if err := hm.checkRekey(oskey, nskey); err != nil {
+		return 0, err
+	}
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return 0, err
+		}
+	}
+	if oskey == nskey {
+		hm.set(entry[K, V]{key: newKey, skey: nskey, value: value, hash: hm.hash(newKey, nskey, value)})
+		return hm.revision, nil
+	}
+	if hm.expiring() {
+		// An expired entry of the new key is replaced like a missing one.
+		hm.expire(nskey)
+	}
+
+	from, _ := hm.detach(oskey)
+	hm.revision++
+	e := entry[K, V]{key: newKey, skey: nskey, value: value, hash: hm.hash(newKey, nskey, value), version: hm.revision}
+	target := hm.buckets
+	if hm.next != nil {
+		target = hm.next
+	}
+	index := target.getIndex(e.hash)
+	hm.tree.Insert(nskey, target.location(index))
+	hm.insert(e, target, index)
+	hm.notifyRekey(&from, &e)
+	hm.maybeResize()
+	return e.version, nil
+}
+
+// checkRekey checks the move of the entry of oskey to nskey, see Rekey.
+// The caller must hold the lock.
+func (hm *HashTable[K, V]) checkRekey(oskey, nskey string) error {
+	if hm.findEntry(oskey) == nil {
+		return fmt.Errorf("key %s: %w", oskey, ErrNotFound)
+	}
+	if oskey == nskey {
+		return nil
+	}
+	if err := hm.checkKey(nskey); err != nil {
+		return err
+	}
+	if e := hm.findEntry(nskey); e != nil {
+		return &ConflictError{Key: nskey, Actual: e.version}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package generic
+
+const (
+	// rehashStep is the number of buckets migrated by every write while a
+	// resize is in progress.
+	rehashStep = 4
+	// generationBit marks which table generation a location stored in the
+	// trie belongs to.
+	generationBit = 1 << 63
+)
+
+// table is one generation of buckets. While a resize is in progress the
+// old and the new generation are both alive.
+type table[K comparable, V any] struct {
+	backend[K, V]
+	generation uint64
+}
+
+// newTable returns a table generation using the configured backend.
+// chainCap is the capacity chaining buckets are preallocated with.
+func (hm *HashTable[K, V]) newTable(size int, generation uint64, chainCap int) *table[K, V] {
+	if hm.openAddressing {
+		return &table[K, V]{backend: newRobinHood[K, V](size), generation: generation}
+	}
+	return &table[K, V]{backend: newChaining[K, V](size, chainCap), generation: generation}
+}
+
+// getIndex returns the home index of hash in the table.
+func (t *table[K, V]) getIndex(hash uint64) uint64 {
+	return hash % uint64(t.size())
+}
+
+// location returns the value the trie stores for a key held in the given
+// bucket: the bucket index with the parity of the table generation in the
+// top bit, so an index is never mistaken for one of the other table.
+func (t *table[K, V]) location(index uint64) uint64 {
+	return index | (t.generation&1)<<63
+}
+
+// locate resolves a location stored in the trie to its table and bucket
+// index.
+func (hm *HashTable[K, V]) locate(location interface{}) (*table[K, V], uint64) {
+	loc := location.(uint64)
+	index := loc &^ generationBit
+	if hm.next != nil && loc&generationBit == hm.next.location(0) {
+		return hm.next, index
+	}
+	return hm.buckets, index
+}
+
+// tables returns the live table generations, oldest first.
+func (hm *HashTable[K, V]) tables() []*table[K, V] {
+	if hm.next != nil {
+		return []*table[K, V]{hm.buckets, hm.next}
+	}
+	return []*table[K, V]{hm.buckets}
+}
+
+// moved returns the callback that records the new location of an entry
+// a backend of t moved to another index.
+func (hm *HashTable[K, V]) moved(t *table[K, V]) func(e *entry[K, V], index uint64) {
+	return func(e *entry[K, V], index uint64) {
+		hm.tree.Insert(e.skey, t.location(index))
+	}
+}
+
+// maybeResize starts growing or shrinking the table when the load factor
+// leaves the configured bounds. The table never shrinks below the size it
+// was created with.
+func (hm *HashTable[K, V]) maybeResize() {
+	if hm.maxLoad <= 0 || hm.next != nil {
+		return
+	}
+	load := float64(hm.count) / float64(hm.size)
+	switch {
+	case load > hm.maxLoad:
+		hm.startResize(hm.size * 2)
+	case load < hm.minLoad && hm.size > hm.minSize:
+		size := hm.size / 2
+		if size < hm.minSize {
+			size = hm.minSize
+		}
+		hm.startResize(size)
+	}
+}
+
+func (hm *HashTable[K, V]) startResize(size int) {
+	hm.next = hm.newTable(size, hm.buckets.generation+1, 0)
+	hm.rehashIdx = 0
+}
+
+// rehashStep migrates a few buckets of an ongoing resize, so the work is
+// spread over the writes instead of pausing a single one. Every migrated
+// key gets its new location in the trie.
+func (hm *HashTable[K, V]) rehashStep() {
+	if hm.next == nil {
+		return
+	}
+
+	// Visit a bounded number of empty buckets, so a sparse table doesn't
+	// turn one step into a full scan.
+	moved := hm.moved(hm.next)
+	for migrated, visited := 0, 0; migrated < rehashStep && visited < rehashStep*10; visited++ {
+		if hm.rehashIdx == hm.buckets.size() {
+			break
+		}
+		chain := hm.buckets.drain(uint64(hm.rehashIdx))
+		for _, e := range chain {
+			index := hm.next.insert(e, moved)
+			hm.tree.Insert(e.skey, hm.next.location(index))
+		}
+		hm.rehashIdx++
+		if len(chain) > 0 {
+			migrated++
+		}
+	}
+
+	if hm.rehashIdx == hm.buckets.size() {
+		hm.buckets, hm.next = hm.next, nil
+		hm.size = hm.buckets.size()
+		hm.rehashIdx = 0
+	}
+}
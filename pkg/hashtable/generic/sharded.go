@@ -0,0 +1,245 @@
+package generic
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// shardSeed seeds the hash that picks the shard of a key. It differs from
+// any seed a table is likely given, so keys of one shard still spread
+// over all of its buckets.
+const shardSeed = 0x9e3779b97f4a7c15
+
+// ShardedHashTable splits its keys over independent HashTables, each with
+// its own lock, buckets and prefix index, so writes to different shards
+// run in parallel. Queries over many keys ask every shard and merge the
+// results in key order.
+type ShardedHashTable[K comparable, V any] struct {
+	shards []*HashTable[K, V]
+}
+
+// NewShardedHashTable returns a hashtable of the given number of shards,
+// splitting size buckets evenly between them; the first size%shards
+// shards get one bucket more. hash and opts configure every shard as they
+// do in NewHashTable.
+func NewShardedHashTable[K comparable, V any](shards, size int, hash func(K) uint64, opts ...Option) (*ShardedHashTable[K, V], error) {
+	if shards <= 0 {
+		return nil, errors.New("sharded hashtable needs at least one shard")
+	}
+	if size < shards {
+		return nil, errors.New("hashmap size should be at least the number of shards")
+	}
+	st := &ShardedHashTable[K, V]{shards: make([]*HashTable[K, V], shards)}
+	for i := range st.shards {
+		buckets := size / shards
+		if i < size%shards {
+			buckets++
+		}
+		hm, err := NewHashTable[K, V](buckets, hash, opts...)
+		if err != nil {
+			return nil, err
+		}
+		st.shards[i] = hm
+	}
+	return st, nil
+}
+
+// shard returns the shard holding the key with the given string form.
+func (st *ShardedHashTable[K, V]) shard(skey string) *HashTable[K, V] {
+	h := XXHash{}.Hash(skey, shardSeed)
+	return st.shards[(h>>32)%uint64(len(st.shards))]
+}
+
+// keyString returns the string form of key, the same in every shard.
+func (st *ShardedHashTable[K, V]) keyString(key K) string {
+	return st.shards[0].keyString(key)
+}
+
+// Shards returns the number of shards.
+func (st *ShardedHashTable[K, V]) Shards() int {
+	return len(st.shards)
+}
+
+// Size returns the number of buckets of all shards.
+func (st *ShardedHashTable[K, V]) Size() int {
+	size := 0
+	for _, hm := range st.shards {
+		size += hm.Size()
+	}
+	return size
+}
+
+// Len returns the number of live entries of all shards.
+func (st *ShardedHashTable[K, V]) Len() int {
+	n := 0
+	for _, hm := range st.shards {
+		n += hm.Len()
+	}
+	return n
+}
+
+// LoadFactor returns the number of entries per bucket over all shards.
+func (st *ShardedHashTable[K, V]) LoadFactor() float64 {
+	var entries float64
+	for _, hm := range st.shards {
+		entries += hm.LoadFactor() * float64(hm.Size())
+	}
+	return entries / float64(st.Size())
+}
+
+// CheckInvariants checks every shard, see HashTable.CheckInvariants, and
+// that every key is held by the shard it belongs to.
+func (st *ShardedHashTable[K, V]) CheckInvariants() error {
+	for i, hm := range st.shards {
+		if err := hm.CheckInvariants(); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		for _, skey := range hm.GetAllKeys() {
+			if st.shard(skey) != hm {
+				return fmt.Errorf("shard %d: holds key %s of another shard", i, skey)
+			}
+		}
+	}
+	return nil
+}
+
+// Set sets the value for an associated key and returns the index of the
+// bucket holding it within its shard.
+func (st *ShardedHashTable[K, V]) Set(key K, value V) (uint64, error) {
+	return st.shard(st.keyString(key)).Set(key, value)
+}
+
+// SetWithTTL sets the value for an associated key and makes it expire
+// once ttl has passed, see HashTable.SetWithTTL.
+func (st *ShardedHashTable[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (uint64, error) {
+	return st.shard(st.keyString(key)).SetWithTTL(key, value, ttl)
+}
+
+// Get returns the value associated with a key, and an boolean indicating
+// whether the value exists or not.
+func (st *ShardedHashTable[K, V]) Get(key K) (V, bool) {
+	return st.shard(st.keyString(key)).Get(key)
+}
+
+// Delete deletes the entry associated with a key and reports whether it
+// existed.
+func (st *ShardedHashTable[K, V]) Delete(key K) bool {
+	return st.shard(st.keyString(key)).Delete(key)
+}
+
+// Close stops the janitors of all shards, see HashTable.Close.
+func (st *ShardedHashTable[K, V]) Close() error {
+	for _, hm := range st.shards {
+		hm.Close()
+	}
+	return nil
+}
+
+// GetAllKeys returns the keys of all shards in key order.
+func (st *ShardedHashTable[K, V]) GetAllKeys() []string {
+	lists := make([][]string, len(st.shards))
+	for i, hm := range st.shards {
+		lists[i] = hm.GetAllKeys()
+	}
+	return mergeSorted(lists, func(s string) string { return s })
+}
+
+// GetKeysWithPrefix returns the keys of all shards starting with prefix,
+// in key order.
+func (st *ShardedHashTable[K, V]) GetKeysWithPrefix(prefix string) []string {
+	lists := make([][]string, len(st.shards))
+	for i, hm := range st.shards {
+		lists[i] = hm.GetKeysWithPrefix(prefix)
+	}
+	return mergeSorted(lists, func(s string) string { return s })
+}
+
+// GetPairsWithPrefix returns the key value pairs of all shards whose key
+// starts with prefix, in key order.
+func (st *ShardedHashTable[K, V]) GetPairsWithPrefix(prefix string) []Pair[K, V] {
+	lists := make([][]Pair[K, V], len(st.shards))
+	for i, hm := range st.shards {
+		lists[i] = hm.GetPairsWithPrefix(prefix)
+	}
+	return mergeSorted(lists, st.pairKey)
+}
+
+// GetAllPairs returns the key value pairs of all shards in key order.
+func (st *ShardedHashTable[K, V]) GetAllPairs() []Pair[K, V] {
+	lists := make([][]Pair[K, V], len(st.shards))
+	for i, hm := range st.shards {
+		lists[i] = hm.GetAllPairs()
+	}
+	return mergeSorted(lists, st.pairKey)
+}
+
+func (st *ShardedHashTable[K, V]) pairKey(p Pair[K, V]) string {
+	return st.keyString(p.Key)
+}
+
+// Distribution returns the chain length statistics of all shards
+// together, as if their buckets formed one table.
+func (st *ShardedHashTable[K, V]) Distribution() Distribution {
+	var total Distribution
+	size := 0
+	for _, hm := range st.shards {
+		d := hm.Distribution()
+		size += hm.Size()
+		total.Buckets += d.Buckets
+		total.Entries += d.Entries
+		for len(total.Histogram) < len(d.Histogram) {
+			total.Histogram = append(total.Histogram, 0)
+		}
+		for n, count := range d.Histogram {
+			total.Histogram[n] += count
+		}
+	}
+	total.LoadFactor = float64(total.Entries) / float64(size)
+	total.summarize()
+	return total
+}
+
+// mergeSorted merges lists, each sorted by key, into one sorted list.
+func mergeSorted[T any](lists [][]T, key func(T) string) []T {
+	n := 0
+	h := &mergeHeap[T]{key: key}
+	for _, l := range lists {
+		n += len(l)
+		if len(l) > 0 {
+			h.lists = append(h.lists, l)
+		}
+	}
+	heap.Init(h)
+	res := make([]T, 0, n)
+	for h.Len() > 0 {
+		l := h.lists[0]
+		res = append(res, l[0])
+		if len(l) == 1 {
+			heap.Pop(h)
+		} else {
+			h.lists[0] = l[1:]
+			heap.Fix(h, 0)
+		}
+	}
+	return res
+}
+
+// mergeHeap orders non-empty sorted lists by the key of their first item.
+type mergeHeap[T any] struct {
+	lists [][]T
+	key   func(T) string
+}
+
+func (h *mergeHeap[T]) Len() int { return len(h.lists) }
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	return h.key(h.lists[i][0]) < h.key(h.lists[j][0])
+}
+func (h *mergeHeap[T]) Swap(i, j int)      { h.lists[i], h.lists[j] = h.lists[j], h.lists[i] }
+func (h *mergeHeap[T]) Push(x interface{}) { h.lists = append(h.lists, x.([]T)) }
+func (h *mergeHeap[T]) Pop() interface{} {
+	last := h.lists[len(h.lists)-1]
+	h.lists = h.lists[:len(h.lists)-1]
+	return last
+}
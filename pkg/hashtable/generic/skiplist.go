@@ -0,0 +1,199 @@
+package generic
+
+// skipListMaxLevel bounds the height of skip list nodes, enough for far
+// more entries than fit in memory at a branching factor of 4.
+const skipListMaxLevel = 32
+
+// slLink points from a node to the next node at one level. span is the
+// number of bottom level steps the link covers.
+type slLink struct {
+	node *slNode
+	span int
+}
+
+type slNode struct {
+	score float64
+	key   string
+	next  []slLink
+}
+
+// less orders nodes by score, then by key.
+func (n *slNode) less(score float64, key string) bool {
+	return n.score < score || n.score == score && n.key < key
+}
+
+// skipList is an indexable skip list of scored keys. Every link knows how
+// many nodes it skips, which makes finding the rank of a key and the key
+// at a rank as cheap as a search.
+type skipList struct {
+	head   *slNode
+	level  int
+	length int
+	// rnd is the state of the xorshift generator picking node levels.
+	rnd uint64
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &slNode{next: make([]slLink, skipListMaxLevel)},
+		level: 1,
+		rnd:   0x2545f4914f6cdd1d,
+	}
+}
+
+// randomLevel returns the level of a new node, each level being four
+// times less likely than the one below.
+func (l *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel {
+		l.rnd ^= l.rnd << 13
+		l.rnd ^= l.rnd >> 7
+		l.rnd ^= l.rnd << 17
+		if l.rnd&3 != 0 {
+			break
+		}
+		level++
+	}
+	return level
+}
+
+// insert adds key with the given score. The pair must not be in the list.
+func (l *skipList) insert(score float64, key string) {
+	var update [skipListMaxLevel]*slNode
+	var rank [skipListMaxLevel]int
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.less(score, key) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = l.head
+			update[i].next[i].span = l.length
+		}
+		l.level = level
+	}
+
+	n := &slNode{score: score, key: key, next: make([]slLink, level)}
+	for i := 0; i < level; i++ {
+		n.next[i].node = update[i].next[i].node
+		update[i].next[i].node = n
+		// The new node splits the link of update[i] in two.
+		n.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.length++
+}
+
+// remove deletes key with the given score and reports whether it was in
+// the list.
+func (l *skipList) remove(score float64, key string) bool {
+	var update [skipListMaxLevel]*slNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.less(score, key) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	x = x.next[0].node
+	if x == nil || x.score != score || x.key != key {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// rank returns the 1-based position of key with the given score, or 0
+// if it isn't in the list.
+func (l *skipList) rank(score float64, key string) int {
+	rank := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := x.next[i].node; next != nil && (next.less(score, key) || next.score == score && next.key == key); next = x.next[i].node {
+			rank += x.next[i].span
+			x = next
+		}
+		if x != l.head && x.score == score && x.key == key {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at the 1-based position rank, or nil.
+func (l *skipList) byRank(rank int) *slNode {
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && traversed+x.next[i].span <= rank {
+			traversed += x.next[i].span
+			x = x.next[i].node
+		}
+		if traversed == rank && x != l.head {
+			return x
+		}
+	}
+	return nil
+}
+
+// seek returns the first node with a score of at least score, or nil.
+func (l *skipList) seek(score float64) *slNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.score < score {
+			x = x.next[i].node
+		}
+	}
+	return x.next[0].node
+}
+
+// countBelow returns the number of nodes scoring less than score, or at
+// most score if inclusive is set.
+func (l *skipList) countBelow(score float64, inclusive bool) int {
+	count := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for next := x.next[i].node; next != nil && (next.score < score || inclusive && next.score == score); next = x.next[i].node {
+			count += x.next[i].span
+			x = next
+		}
+	}
+	return count
+}
+
+// keysBetween returns the keys scoring between min and max, both
+// included, in order of score.
+func (l *skipList) keysBetween(min, max float64) []string {
+	var keys []string
+	for n := l.seek(min); n != nil && n.score <= max; n = n.next[0].node {
+		keys = append(keys, n.key)
+	}
+	return keys
+}
@@ -0,0 +1,248 @@
+package generic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// snapshotMagic starts every snapshot, its last two digits are the
+// format version. Version 1 lacks the revision and the entry versions,
+// version 2 the entry expiries.
+const (
+	snapshotMagic   = "HTSNAP03"
+	snapshotVersion = 3
+)
+
+// snapshotProbe is hashed to fingerprint the hasher and seed a snapshot
+// was written with.
+const snapshotProbe = "hashtable snapshot probe"
+
+// maxSnapshotEntry bounds the encoded length of an entry, so a corrupted
+// or forged length doesn't make loading allocate gigabytes before the
+// checksum is checked.
+const maxSnapshotEntry = 1 << 30
+
+// Snapshot header flags.
+const snapshotHashed = 1 << 0
+
+// Codec turns a key and its value into bytes and back, for writing them
+// to snapshots.
+type Codec[K comparable, V any] interface {
+	Encode(key K, value V) ([]byte, error)
+	Decode(data []byte) (K, V, error)
+}
+
+// JSONCodec encodes keys and values with encoding/json. V must not be an
+// interface type, json can't decode into those.
+type JSONCodec[K comparable, V any] struct{}
+
+type jsonRecord[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+func (JSONCodec[K, V]) Encode(key K, value V) ([]byte, error) {
+	return json.Marshal(jsonRecord[K, V]{Key: key, Value: value})
+}
+
+func (JSONCodec[K, V]) Decode(data []byte) (K, V, error) {
+	var r jsonRecord[K, V]
+	err := json.Unmarshal(data, &r)
+	return r.Key, r.Value, err
+}
+
+// fingerprint identifies the hasher and seed of the table; tables with the
+// same fingerprint hash every key alike. It is 0 when no Hasher is set.
+func (hm *HashTable[K, V]) fingerprint() uint64 {
+	if hm.hasher == nil {
+		return 0
+	}
+	return hm.hasher.Hash(snapshotProbe, hm.seed)
+}
+
+// WriteSnapshot writes all entries of the table to w in key order, along
+// with the seed of the table and the hash, version and expiry of every
+// entry. Expired entries are left out. Keys and values are encoded by
+// codec.
+//
+// The snapshot is laid out as the magic "HTSNAP03", a flags byte, the
+// seed, a fingerprint of the hasher and seed, the number of entries and
+// the revision of the table, followed by the entries, each being its
+// hash, its version, its expiry in Unix nanoseconds or 0, the length of
+// its encoded form and the encoded form. A CRC-32 of everything before it
+// ends the snapshot. Integers are little endian, lengths 32 bit, the
+// others 64 bit.
+func (hm *HashTable[K, V]) WriteSnapshot(w io.Writer, codec Codec[K, V]) error {
+	hm.lock.RLock()
+	defer hm.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	var flags byte
+	if hm.hasher != nil {
+		flags |= snapshotHashed
+	}
+	var header [8 + 1 + 8 + 8 + 8 + 8]byte
+	copy(header[:], snapshotMagic)
+	header[8] = flags
+	binary.LittleEndian.PutUint64(header[9:], hm.seed)
+	binary.LittleEndian.PutUint64(header[17:], hm.fingerprint())
+	binary.LittleEndian.PutUint64(header[33:], hm.revision)
+
+	// The entries are collected in a single walk, expired ones are still in
+	// hm.count, and a second walk could see more of them expired once the
+	// clock moved on.
+	var entries []*entry[K, V]
+	hm.walk("", func(e *entry[K, V]) bool {
+		entries = append(entries, e)
+		return true
+	})
+	binary.LittleEndian.PutUint64(header[25:], uint64(len(entries)))
+	if _, err := out.Write(header[:]); err != nil {
+		return err
+	}
+
+	var prefix [8 + 8 + 8 + 4]byte
+	for _, e := range entries {
+		data, err := codec.Encode(e.key, e.value)
+		if err != nil {
+			return fmt.Errorf("encoding key %q: %w", e.skey, err)
+		}
+		if len(data) > maxSnapshotEntry {
+			return fmt.Errorf("encoding key %q: %d bytes exceed the limit of %d", e.skey, len(data), maxSnapshotEntry)
+		}
+		binary.LittleEndian.PutUint64(prefix[:], e.hash)
+		binary.LittleEndian.PutUint64(prefix[8:], e.version)
+		binary.LittleEndian.PutUint64(prefix[16:], uint64(e.expires))
+		binary.LittleEndian.PutUint32(prefix[24:], uint32(len(data)))
+		if _, err := out.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err := bw.Write(sum[:]); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot from r and sets
+// all its entries in the table. The stored hashes are reused when the
+// snapshot was written with the same Hasher and seed as the table uses,
+// otherwise every entry is rehashed, so a snapshot loads into any table.
+// Loaded into an empty table, the entries keep their versions, otherwise
+// they get new ones. Entries keep their expiry, those expired since are
+// removed as usual. Nothing is set if the snapshot is malformed.
+func (hm *HashTable[K, V]) LoadSnapshot(r io.Reader, codec Codec[K, V]) error {
+	crc := crc32.NewIEEE()
+	in := io.TeeReader(bufio.NewReader(r), crc)
+
+	var header [8 + 1 + 8 + 8 + 8 + 8]byte
+	if _, err := io.ReadFull(in, header[:8]); err != nil {
+		return fmt.Errorf("reading snapshot header: %w", err)
+	}
+	version := 0
+	if string(header[:7]) == snapshotMagic[:7] {
+		version = int(header[7] - '0')
+	}
+	if version < 1 || version > snapshotVersion {
+		return errors.New("not a hashtable snapshot")
+	}
+	// Fields a version lacks are read as 0.
+	rest := header[8:]
+	if version < 2 {
+		rest = header[8:33]
+	}
+	if _, err := io.ReadFull(in, rest); err != nil {
+		return fmt.Errorf("reading snapshot header: %w", err)
+	}
+	flags := header[8]
+	fingerprint := binary.LittleEndian.Uint64(header[17:])
+	count := binary.LittleEndian.Uint64(header[25:])
+	revision := binary.LittleEndian.Uint64(header[33:])
+
+	entries := make([]entry[K, V], 0)
+	var prefix [8 + 8 + 8 + 4]byte
+	fields := [][]byte{prefix[:8], prefix[8:16], prefix[16:24], prefix[24:]}
+	switch version {
+	case 1:
+		fields = [][]byte{prefix[:8], prefix[24:]}
+	case 2:
+		fields = [][]byte{prefix[:16], prefix[24:]}
+	}
+	for i := uint64(0); i < count; i++ {
+		for _, field := range fields {
+			if _, err := io.ReadFull(in, field); err != nil {
+				return fmt.Errorf("reading snapshot entry %d: %w", i, err)
+			}
+		}
+		length := binary.LittleEndian.Uint32(prefix[24:])
+		if length > maxSnapshotEntry {
+			return fmt.Errorf("reading snapshot entry %d: length %d exceeds the limit of %d", i, length, maxSnapshotEntry)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return fmt.Errorf("reading snapshot entry %d: %w", i, err)
+		}
+		key, value, err := codec.Decode(data)
+		if err != nil {
+			return fmt.Errorf("decoding snapshot entry %d: %w", i, err)
+		}
+		entries = append(entries, entry[K, V]{
+			key:     key,
+			value:   value,
+			hash:    binary.LittleEndian.Uint64(prefix[:]),
+			version: binary.LittleEndian.Uint64(prefix[8:]),
+			expires: int64(binary.LittleEndian.Uint64(prefix[16:])),
+		})
+	}
+
+	want := crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(in, sum[:]); err != nil {
+		return fmt.Errorf("reading snapshot checksum: %w", err)
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != want {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	for i := range entries {
+		entries[i].skey = hm.keyString(entries[i].key)
+		if err := hm.checkKey(entries[i].skey); err != nil {
+			return fmt.Errorf("snapshot entry %d: %w", i, err)
+		}
+	}
+	// Hashes written under another hasher or seed would place the keys
+	// differently from the keys set later, rehash them.
+	rehash := flags&snapshotHashed == 0 || hm.hasher == nil || fingerprint != hm.fingerprint()
+	// Versions only mean something among the entries of one table.
+	keepVersions := hm.count == 0
+	for _, e := range entries {
+		if rehash {
+			e.hash = hm.hash(e.key, e.skey, e.value)
+		}
+		if !keepVersions {
+			e.version = 0
+		}
+		hm.set(e)
+	}
+	if keepVersions && revision > hm.revision {
+		hm.revision = revision
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package generic
+
+import (
+	"math"
+	"time"
+)
+
+// Now returns the current time of the clock of the table, see WithClock.
+func (hm *HashTable[K, V]) Now() time.Time {
+	return hm.now()
+}
+
+// SetWithTTL sets the value for an associated key like Set, and makes the
+// entry expire once ttl has passed. A ttl of zero or less sets the entry
+// without expiry, like Set.
+func (hm *HashTable[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (uint64, error) {
+	if ttl <= 0 {
+		return hm.Set(key, value)
+	}
+	return hm.SetUntil(key, value, hm.now().Add(ttl))
+}
+
+// SetUntil sets the value for an associated key like Set, and makes the
+// entry expire at deadline. Like Set, it rejects a key the prefix index
+// doesn't accept.
+//
+// An expired entry is gone for every read right away. It is removed from
+// the buckets, the trie and the indexes by the next read or write of its
+// key, by a read of an ordered index, or by the janitor, see WithJanitor;
+// until then it still counts in the Distribution. Watchers see its
+// removal as an EventExpire.
+func (hm *HashTable[K, V]) SetUntil(key K, value V, deadline time.Time) (uint64, error) {
+	return hm.setExpiring(key, value, expiresAt(deadline), nil)
+}
+
+// expiresAt returns the expiry of an entry expiring at deadline.
+func expiresAt(deadline time.Time) int64 {
+	if expires := deadline.UnixNano(); expires != 0 {
+		return expires
+	}
+	// 0 stands for no expiry, the deadline is just as good 1ns later.
+	return 1
+}
+
+// ExpiresAt returns when the entry of a key expires, and whether it
+// expires at all. It is false for missing keys too.
+func (hm *HashTable[K, V]) ExpiresAt(key K) (time.Time, bool) {
+	e, found := hm.getEntry(hm.keyString(key))
+	if !found || e.expires == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, e.expires), true
+}
+
+// expired reports whether e has expired. The caller must hold the lock.
+func (hm *HashTable[K, V]) expired(e *entry[K, V]) bool {
+	return e.expires != 0 && hm.now().UnixNano() >= e.expires
+}
+
+// expiring reports whether any entry has an expiry. The caller must hold
+// the lock.
+func (hm *HashTable[K, V]) expiring() bool {
+	return hm.expiry != nil && hm.expiry.length > 0
+}
+
+// expiredCount returns the number of expired entries not removed yet.
+// The caller must hold the lock.
+func (hm *HashTable[K, V]) expiredCount() int {
+	if !hm.expiring() {
+		return 0
+	}
+	now := hm.now().UnixNano()
+	score := float64(now)
+	count := hm.expiry.countBelow(score, false)
+	// A score only resolves expiries to a few hundred nanoseconds, those
+	// sharing the score of now may still be ahead of it.
+	for n := hm.expiry.seek(score); n != nil && n.score == score; n = n.next[0].node {
+		if e := hm.lookupEntry(n.key); e != nil && e.expires <= now {
+			count++
+		}
+	}
+	return count
+}
+
+// trackExpiry records the expiry of e, after removing the one it had
+// before, if any. The caller must hold the write lock.
+func (hm *HashTable[K, V]) trackExpiry(skey string, before, after int64) {
+	if before == after {
+		return
+	}
+	if before != 0 {
+		hm.expiry.remove(float64(before), skey)
+	}
+	if after != 0 {
+		if hm.expiry == nil {
+			hm.expiry = newSkipList()
+		}
+		hm.expiry.insert(float64(after), skey)
+	}
+}
+
+// expire removes the entry of skey if it has expired. The caller must hold
+// the write lock.
+func (hm *HashTable[K, V]) expire(skey string) {
+	if e := hm.lookupEntry(skey); e != nil && hm.expired(e) {
+		hm.delete(skey)
+	}
+}
+
+// ExpireNow removes all expired entries and returns how many there were.
+// The janitor calls it periodically, see WithJanitor.
+func (hm *HashTable[K, V]) ExpireNow() int {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	if !hm.expiring() {
+		return 0
+	}
+	// Entries sharing a score are ordered by key rather than by expiry, so
+	// every one up to the score of now is checked, see expiredCount.
+	now := hm.now().UnixNano()
+	var due []string
+	for n := hm.expiry.seek(math.Inf(-1)); n != nil && n.score <= float64(now); n = n.next[0].node {
+		if e := hm.lookupEntry(n.key); e != nil && e.expires <= now {
+			due = append(due, n.key)
+		}
+	}
+	for _, skey := range due {
+		hm.delete(skey)
+	}
+	return len(due)
+}
+
+// janitor removes the expired entries every interval until Close.
+func (hm *HashTable[K, V]) janitor(interval time.Duration) {
+	defer close(hm.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			hm.ExpireNow()
+		case <-hm.stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor, if the table has one. The table stays usable,
+// expired entries are then only removed when their keys are accessed.
+func (hm *HashTable[K, V]) Close() error {
+	hm.closeOnce.Do(func() {
+		if hm.stop != nil {
+			close(hm.stop)
+			<-hm.done
+		}
+	})
+	return nil
+}
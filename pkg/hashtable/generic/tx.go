@@ -0,0 +1,139 @@
+package generic
+
+// Change is a change made by a transaction: a key that was set to a value
+// or deleted.
+type Change[K comparable, V any] struct {
+	Key     K
+	Value   V
+	Deleted bool
+}
+
+// Tx is a transaction of Update. Its changes are buffered, its reads see
+// them, and the table sees them only once Update commits.
+type Tx[K comparable, V any] struct {
+	hm *HashTable[K, V]
+	// changes holds the latest change of every key by string form, order
+	// the string forms in the order they were first changed.
+	changes map[string]*Change[K, V]
+	order   []string
+	done    bool
+}
+
+// Update runs fn in a transaction and commits its changes atomically if
+// fn returns nil. If fn returns an error or panics, none of its changes
+// are applied. Neither are they if one sets a key the prefix index doesn't
+// accept; Update returns an error wrapping ErrKeyRejected then. The table
+// is locked while fn runs, so readers never see part of a transaction,
+// and fn must not call other methods of the table.
+func (hm *HashTable[K, V]) Update(fn func(tx *Tx[K, V]) error) error {
+	return hm.update(fn, nil)
+}
+
+// update is Update calling prepare, unless it is nil, with the changes of
+// the transaction once they are checked and before they are committed. If
+// prepare fails, nothing is committed and its error is returned. prepare
+// is called with the table locked, so it must not use the table.
+func (hm *HashTable[K, V]) update(fn func(tx *Tx[K, V]) error, prepare func(changes []Change[K, V]) error) error {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	tx := &Tx[K, V]{hm: hm, changes: make(map[string]*Change[K, V])}
+	defer func() { tx.done = true }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.validate(); err != nil {
+		return err
+	}
+	if prepare != nil {
+		if err := prepare(tx.Changes()); err != nil {
+			return err
+		}
+	}
+	tx.commit()
+	return nil
+}
+
+func (tx *Tx[K, V]) check() {
+	if tx.done {
+		panic("generic: Tx used after Update returned")
+	}
+}
+
+// change records c for the key with the string form skey.
+func (tx *Tx[K, V]) change(skey string, c Change[K, V]) {
+	if old, ok := tx.changes[skey]; ok {
+		*old = c
+		return
+	}
+	tx.changes[skey] = &c
+	tx.order = append(tx.order, skey)
+}
+
+// Get returns the value associated with a key as the transaction sees
+// it, and whether the value exists.
+func (tx *Tx[K, V]) Get(key K) (V, bool) {
+	tx.check()
+	skey := tx.hm.keyString(key)
+	if c, ok := tx.changes[skey]; ok {
+		if c.Deleted {
+			return *new(V), false
+		}
+		return c.Value, true
+	}
+	if e := tx.hm.findEntry(skey); e != nil {
+		return e.value, true
+	}
+	return *new(V), false
+}
+
+// Set sets the value for an associated key.
+func (tx *Tx[K, V]) Set(key K, value V) {
+	tx.check()
+	tx.change(tx.hm.keyString(key), Change[K, V]{Key: key, Value: value})
+}
+
+// Delete deletes the entry associated with a key, and reports whether it
+// existed as the transaction sees it.
+func (tx *Tx[K, V]) Delete(key K) bool {
+	_, found := tx.Get(key)
+	if found {
+		tx.change(tx.hm.keyString(key), Change[K, V]{Key: key, Deleted: true})
+	}
+	return found
+}
+
+// Changes returns the changes made so far, one per key, in the order the
+// keys were first changed.
+func (tx *Tx[K, V]) Changes() []Change[K, V] {
+	tx.check()
+	changes := make([]Change[K, V], len(tx.order))
+	for i, skey := range tx.order {
+		changes[i] = *tx.changes[skey]
+	}
+	return changes
+}
+
+// validate checks the keys of the changes before commit applies any of
+// them. The caller must hold the write lock.
+func (tx *Tx[K, V]) validate() error {
+	for _, skey := range tx.order {
+		if err := tx.hm.checkKey(skey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit applies the changes to the table. The caller must hold the write
+// lock.
+func (tx *Tx[K, V]) commit() {
+	for _, skey := range tx.order {
+		c := tx.changes[skey]
+		if c.Deleted {
+			tx.hm.delete(skey)
+			continue
+		}
+		tx.hm.set(entry[K, V]{key: c.Key, skey: skey, value: c.Value, hash: tx.hm.hash(c.Key, skey, c.Value)})
+	}
+}
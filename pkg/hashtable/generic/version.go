@@ -0,0 +1,95 @@
+package generic
+
+import "fmt"
+
+// ConflictError is returned by CompareAndSet and CompareAndDelete when the
+// entry doesn't have the expected version, because someone else changed
+// it in the meantime.
+type ConflictError struct {
+	// Key is the string form of the key.
+	Key string
+	// Expected is the version the caller expected, Actual the version of
+	// the entry. Version 0 stands for a missing entry.
+	Expected, Actual uint64
+}
+
+func (e *ConflictError) Error() string {
+	if e.Actual == 0 {
+		return fmt.Sprintf("key %s: expected version %d, but the key doesn't exist", e.Key, e.Expected)
+	}
+	return fmt.Sprintf("key %s: expected version %d, but it is at version %d", e.Key, e.Expected, e.Actual)
+}
+
+// GetVersioned returns the value associated with a key along with its
+// version, and whether the value exists. Every Set gives the entry a
+// higher version than any entry had before, even one deleted since.
+func (hm *HashTable[K, V]) GetVersioned(key K) (V, uint64, bool) {
+	e, found := hm.getEntry(hm.keyString(key))
+	return e.value, e.version, found
+}
+
+// version returns the version of the entry stored for the string form of
+// a key, 0 if there is none. The caller must hold the lock.
+func (hm *HashTable[K, V]) version(skey string) uint64 {
+	if e := hm.findEntry(skey); e != nil {
+		return e.version
+	}
+	return 0
+}
+
+// CompareAndSet sets the value for a key if the entry is at the expected
+// version, 0 meaning the key must not exist yet, and returns the new
+// version. Otherwise it returns a *ConflictError, or an error wrapping
+// ErrKeyRejected for a key the prefix index doesn't accept.
+func (hm *HashTable[K, V]) CompareAndSet(key K, value V, expected uint64) (uint64, error) {
+	return hm.compareAndSet(key, value, expected, nil)
+}
+
+// compareAndSet is CompareAndSet calling prepare, unless it is nil, once
+// the version is checked and before the value is set. If prepare fails,
+// nothing is set and its error is returned. prepare is called with the
+// table locked, so it must not use the table.
+func (hm *HashTable[K, V]) compareAndSet(key K, value V, expected uint64, prepare func() error) (uint64, error) {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	skey := hm.keyString(key)
+	if err := hm.checkKey(skey); err != nil {
+		return 0, err
+	}
+	if actual := hm.version(skey); actual != expected {
+		return 0, &ConflictError{Key: skey, Expected: expected, Actual: actual}
+	}
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return 0, err
+		}
+	}
+	hm.set(entry[K, V]{key: key, skey: skey, value: value, hash: hm.hash(key, skey, value)})
+	return hm.revision, nil
+}
+
+// CompareAndDelete deletes the entry for a key if it is at the expected
+// version. Otherwise it returns a *ConflictError.
+func (hm *HashTable[K, V]) CompareAndDelete(key K, expected uint64) error {
+	return hm.compareAndDelete(key, expected, nil)
+}
+
+// compareAndDelete is CompareAndDelete calling prepare like
+// compareAndSet.
+func (hm *HashTable[K, V]) compareAndDelete(key K, expected uint64, prepare func() error) error {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	skey := hm.keyString(key)
+	if actual := hm.version(skey); actual != expected || actual == 0 {
+		return &ConflictError{Key: skey, Expected: expected, Actual: actual}
+	}
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return err
+		}
+	}
+	hm.delete(skey)
+	return nil
+}
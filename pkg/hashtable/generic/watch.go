@@ -0,0 +1,156 @@
+package generic
+
+import "strings"
+
+// defaultWatchBuffer is the number of events a watcher may fall behind by
+// default, see WithWatchBuffer.
+const defaultWatchBuffer = 256
+
+// EventKind tells how a change affected an entry.
+type EventKind int
+
+const (
+	// EventSet is the set of a key that didn't exist.
+	EventSet EventKind = iota + 1
+	// EventUpdate is the set of a key that existed.
+	EventUpdate
+	// EventDelete is the delete of a key.
+	EventDelete
+	// EventExpire is the removal of an expired key, see SetUntil.
+	EventExpire
+	// EventEvict is the removal of a key to make room, see WithCapacity.
+	EventEvict
+	// EventRekey is the move of an entry to another key, see Rekey.
+	EventRekey
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventSet:
+		return "set"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	case EventRekey:
+		return "rekey"
+	}
+	return "unknown"
+}
+
+// Event is a change of an entry delivered by Watch.
+type Event[K comparable, V any] struct {
+	Kind EventKind
+	Key  K
+	// OldKey is the key an entry had before EventRekey moved it to Key,
+	// the zero value for other kinds.
+	OldKey K
+	// Old is the value before the change, New the value after it. Old is
+	// the zero value for EventSet, New for EventDelete, EventExpire and
+	// EventEvict. A value changed in place before it is set again is the
+	// same in both.
+	Old, New V
+	// Version is the version of the entry after the change, or the one it
+	// had if it was removed.
+	Version uint64
+}
+
+// watcher is a subscription made by Watch.
+type watcher[K comparable, V any] struct {
+	prefix string
+	events chan Event[K, V]
+}
+
+// Watch subscribes to the changes of the keys whose string form starts
+// with prefix, all keys for an empty prefix. Every Set, Delete, committed
+// transaction, CompareAndSet and loaded snapshot delivers its events in
+// the order the changes are applied, a transaction in the order of its
+// first change of every key. A Rekey is a single event, delivered to the
+// watchers of either key.
+//
+// Events are sent without blocking the change. A watcher that falls more
+// than the watch buffer, see WithWatchBuffer, behind is dropped: its
+// channel is closed after the events it holds, and it should read the
+// table again and watch anew. cancel ends the subscription and closes the
+// channel; it may be called more than once.
+func (hm *HashTable[K, V]) Watch(prefix string) (events <-chan Event[K, V], cancel func()) {
+	w := &watcher[K, V]{prefix: prefix, events: make(chan Event[K, V], hm.watchBuffer)}
+
+	hm.lock.Lock()
+	hm.watchers = append(hm.watchers, w)
+	hm.lock.Unlock()
+
+	return w.events, func() {
+		hm.lock.Lock()
+		defer hm.lock.Unlock()
+		hm.unwatch(w)
+	}
+}
+
+// unwatch removes w and closes its channel, unless it was removed
+// already. The caller must hold the write lock.
+func (hm *HashTable[K, V]) unwatch(w *watcher[K, V]) {
+	for i, other := range hm.watchers {
+		if other == w {
+			hm.watchers = append(hm.watchers[:i], hm.watchers[i+1:]...)
+			close(w.events)
+			return
+		}
+	}
+}
+
+// notify sends the event of a change of e to the watchers of its key. old
+// is the value e had before. The caller must hold the write lock.
+func (hm *HashTable[K, V]) notify(kind EventKind, e *entry[K, V], old V) {
+	if len(hm.watchers) == 0 {
+		return
+	}
+	ev := Event[K, V]{Kind: kind, Key: e.key, Old: old, Version: e.version}
+	if kind == EventSet || kind == EventUpdate {
+		ev.New = e.value
+	}
+	hm.deliver(ev, e.skey)
+}
+
+// notifyRekey sends the event of the move of from to the entry e. The
+// caller must hold the write lock.
+func (hm *HashTable[K, V]) notifyRekey(from, e *entry[K, V]) {
+	if len(hm.watchers) == 0 {
+		return
+	}
+	ev := Event[K, V]{Kind: EventRekey, Key: e.key, OldKey: from.key, Old: from.value, New: e.value, Version: e.version}
+	hm.deliver(ev, from.skey, e.skey)
+}
+
+// deliver sends ev to the watchers of any of the string forms of keys.
+// The caller must hold the write lock.
+func (hm *HashTable[K, V]) deliver(ev Event[K, V], skeys ...string) {
+	var dropped []*watcher[K, V]
+	for _, w := range hm.watchers {
+		if !watches(w, skeys) {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			dropped = append(dropped, w)
+		}
+	}
+	for _, w := range dropped {
+		hm.unwatch(w)
+	}
+}
+
+// watches reports whether w watches any of skeys.
+func watches[K comparable, V any](w *watcher[K, V], skeys []string) bool {
+	for _, skey := range skeys {
+		if strings.HasPrefix(skey, w.prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,17 @@
 package hashtable
 
 import (
-	"errors"
 	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
 	"github.com/matinhimself/trie/pkg/trie"
-	"sync"
+	"time"
 )
 
 type node struct {
 	Value HashAble
+	// Version is the version of the node when it was read, see
+	// CompareAndSet.
+	Version uint64
 }
 
 func (n node) String() string {
@@ -26,168 +29,326 @@ type HashAble interface {
 // student in a hashtable and its
 // hash value in a trie tree as a pair of
 // hash value and student id.
+//
+// It adapts a generic.HashTable keyed by GetKey and hashed by ToHash to
+// the HashAble interface; all other methods are those of the generic
+// table.
 type HashTable struct {
-	lock    sync.RWMutex
-	size    int
-	count   int
-	buckets [][]node
-	tree    *trie.Trie
+	*generic.HashTable[string, HashAble]
 }
 
-func (hm *HashTable) Size() int {
-	return hm.size
+// Option configures a HashTable in NewHashTable.
+type Option = generic.Option
+
+// DOTOptions controls which part of a HashTable WriteDOT renders.
+type DOTOptions = generic.DOTOptions
+
+// Cond is a condition on an indexed field for Query.Where, see
+// generic.Cond.
+type Cond = generic.Cond
+
+// Condition constructors, see their documentation in package generic.
+var (
+	Eq        = generic.Eq
+	HasPrefix = generic.HasPrefix
+	Contains  = generic.Contains
+	Between   = generic.Between
+)
+
+// Codec encodes the stored objects for WriteSnapshot and LoadSnapshot.
+// Objects hashed by ToHash are always rehashed when loaded.
+type Codec = generic.Codec[string, HashAble]
+
+// ConflictError is returned by CompareAndSet and CompareAndDelete when
+// the node was changed since it was read.
+type ConflictError = generic.ConflictError
+
+// Event is a change of a stored object delivered by Watch, see
+// generic.Event.
+type Event = generic.Event[string, HashAble]
+
+// EventKind tells how a change affected an object.
+type EventKind = generic.EventKind
+
+// The kinds of events, see their documentation in package generic.
+const (
+	EventSet    = generic.EventSet
+	EventUpdate = generic.EventUpdate
+	EventDelete = generic.EventDelete
+	EventExpire = generic.EventExpire
+	EventEvict  = generic.EventEvict
+	EventRekey  = generic.EventRekey
+)
+
+// ErrNotFound is returned, wrapped, by Rekey when the old key doesn't
+// exist.
+var ErrNotFound = generic.ErrNotFound
+
+// SetResult is what SetMany did with an object, see generic.SetResult.
+type SetResult = generic.SetResult
+
+// SetStatus tells what SetMany did with an object.
+type SetStatus = generic.SetStatus
+
+// The outcomes of SetMany, see their documentation in package generic.
+const (
+	Inserted = generic.Inserted
+	Updated  = generic.Updated
+	Rejected = generic.Rejected
+)
+
+// EvictionPolicy decides which node a full HashTable evicts, see
+// generic.EvictionPolicy.
+type EvictionPolicy = generic.EvictionPolicy
+
+// CacheStats counts the lookups and evictions of a HashTable with a
+// capacity.
+type CacheStats = generic.CacheStats
+
+// The built-in eviction policies, see their documentation in package
+// generic.
+var (
+	NewLRU   = generic.NewLRU
+	NewLFU   = generic.NewLFU
+	NewClock = generic.NewClock
+)
+
+// Distribution describes the chain lengths of a HashTable, see
+// generic.Distribution.
+type Distribution = generic.Distribution
+
+// Hasher hashes the string form of a key, see generic.Hasher.
+type Hasher = generic.Hasher
+
+// The built-in hashers, see their documentation in package generic.
+type (
+	FNV1a   = generic.FNV1a
+	Jenkins = generic.Jenkins
+	SipHash = generic.SipHash
+	XXHash  = generic.XXHash
+	MapHash = generic.MapHash
+)
+
+// NewMapHash returns a MapHash with a new random seed.
+func NewMapHash() *MapHash {
+	return generic.NewMapHash()
 }
 
-func NewHashTable(size int) (*HashTable, error) {
-	hm := new(HashTable)
-	if size <= 0 {
-		return nil, errors.New("hashmap size should be > 1")
+// NewHashTable returns a hashtable with the given number of buckets,
+// configured by the given options.
+func NewHashTable(size int, opts ...Option) (*HashTable, error) {
+	opts = append([]Option{generic.WithValueHash(HashAble.ToHash), WithPrefixIndex(newTrie)}, opts...)
+	t, err := generic.NewHashTable[string, HashAble](size, nil, opts...)
+	if err != nil {
+		return nil, err
 	}
+	return &HashTable{HashTable: t}, nil
+}
 
-	hm.buckets = make([][]node, size)
-	hm.size = size
-	hm.count = 0
-	hm.tree = trie.NewTrie()
-	for i := range hm.buckets {
-		hm.buckets[i] = make([]node, 0, 20)
-	}
-	return hm, nil
+// newTrie returns the digit trie a hashtable keeps its student IDs in
+// unless WithPrefixIndex says otherwise.
+func newTrie() trie.PrefixIndex {
+	return trie.NewTrie()
+}
+
+// WithPrefixIndex makes the hashtable store its keys in the index returned
+// by newIndex instead of the default digit trie, see
+// generic.WithPrefixIndex.
+func WithPrefixIndex(newIndex func() trie.PrefixIndex) Option {
+	return generic.WithPrefixIndex(newIndex)
+}
+
+// WithAutoResize makes the hashtable grow and shrink with its load factor,
+// see generic.WithAutoResize.
+func WithAutoResize(minLoad, maxLoad float64) Option {
+	return generic.WithAutoResize(minLoad, maxLoad)
+}
+
+// WithOpenAddressing stores the nodes using Robin Hood hashing, see
+// generic.WithOpenAddressing.
+func WithOpenAddressing() Option {
+	return generic.WithOpenAddressing()
+}
+
+// WithHasher makes the hashtable hash the keys of the stored objects with
+// h instead of calling their ToHash, see generic.WithHasher.
+func WithHasher(h Hasher) Option {
+	return generic.WithHasher(h)
+}
+
+// WithSeed sets the seed passed to the Hasher of the table, see
+// generic.WithSeed.
+func WithSeed(seed uint64) Option {
+	return generic.WithSeed(seed)
+}
+
+// WithIndex adds a secondary index over the stored objects, see
+// generic.WithIndex.
+func WithIndex(name string, extract func(HashAble) []string) Option {
+	return generic.WithIndex(name, extract)
+}
+
+// WithOrderedIndex adds an index ordering the stored objects by score,
+// see generic.WithOrderedIndex.
+func WithOrderedIndex(name string, score func(HashAble) float64) Option {
+	return generic.WithOrderedIndex(name, score)
 }
 
-// getIndex hashes the given key and returns its index in
-// buckets array.
-func (hm *HashTable) getIndex(key HashAble) uint64 {
-	rn := key.ToHash() % uint64(hm.size)
-	return rn
+// WithWatchBuffer sets how many events a watcher may fall behind by, see
+// generic.WithWatchBuffer.
+func WithWatchBuffer(n int) Option {
+	return generic.WithWatchBuffer(n)
+}
+
+// WithClock makes the hashtable read the time from now, see
+// generic.WithClock.
+func WithClock(now func() time.Time) Option {
+	return generic.WithClock(now)
+}
+
+// WithJanitor removes the expired nodes every interval until Close, see
+// generic.WithJanitor.
+func WithJanitor(interval time.Duration) Option {
+	return generic.WithJanitor(interval)
+}
+
+// WithCapacity bounds the hashtable to capacity nodes, evicting by the
+// policy newPolicy returns, see generic.WithCapacity.
+func WithCapacity(capacity int, newPolicy func() EvictionPolicy) Option {
+	return generic.WithCapacity(capacity, newPolicy)
+}
+
+// WithEvictionCallback makes the hashtable call onEvict with every object
+// it evicts, see generic.WithEvictionCallback.
+func WithEvictionCallback(onEvict func(obj HashAble)) Option {
+	return generic.WithEvictionCallback(func(_ string, obj HashAble) {
+		onEvict(obj)
+	})
+}
+
+// Tokens splits s into lower case words, see generic.Tokens.
+func Tokens(s string) []string {
+	return generic.Tokens(s)
 }
 
 // Set sets the value for an associated key in the hashmap.
-// given object should implements HashAble interface.
-func (hm *HashTable) Set(obj HashAble) uint64 {
-	hm.lock.Lock()
-	defer hm.lock.Unlock()
-
-	index := hm.getIndex(obj)
-	chain := hm.buckets[index]
-	found := false
-
-	// check if the key already exists
-	for i := range chain {
-		// if found, update the node
-		node := &chain[i]
-		if node.Value.Equals(&obj) {
-			node.Value = obj
-			found = true
-		}
-	}
-	if found { // hashmap has been updated
-		return index
-	}
+// given object should implements HashAble interface. A key the prefix
+// index doesn't accept is rejected with an error, see
+// generic.HashTable.Set.
+func (hm *HashTable) Set(obj HashAble) (uint64, error) {
+	return hm.HashTable.Set(obj.GetKey(), obj)
+}
+
+// SetWithTTL sets the object like Set and makes it expire once ttl has
+// passed, see generic.HashTable.SetWithTTL.
+func (hm *HashTable) SetWithTTL(obj HashAble, ttl time.Duration) (uint64, error) {
+	return hm.HashTable.SetWithTTL(obj.GetKey(), obj, ttl)
+}
 
-	// add a new node
-	node := node{Value: obj}
-	chain = append(chain, node)
-	hm.buckets[index] = chain
-	hm.count++
-	hm.tree.Insert(obj.GetKey(), index)
-	return index
+// SetMany sets all objects under a single lock and returns what happened
+// to each of them, see generic.HashTable.SetMany.
+func (hm *HashTable) SetMany(objs []HashAble) []SetResult {
+	return hm.HashTable.SetMany(pairsOf(objs))
 }
 
-// GetAllKeys returns all keys stored in the trie.
-func (hm *HashTable) GetAllKeys() []string {
-	return hm.tree.GetAllKeys()
+// LoadSorted is SetMany for objects sorted by key, see
+// generic.HashTable.LoadSorted.
+func (hm *HashTable) LoadSorted(objs []HashAble) []SetResult {
+	return hm.HashTable.LoadSorted(pairsOf(objs))
 }
 
+// pairsOf pairs every object with its key.
+func pairsOf(objs []HashAble) []generic.Pair[string, HashAble] {
+	pairs := make([]generic.Pair[string, HashAble], len(objs))
+	for i, obj := range objs {
+		pairs[i] = generic.Pair[string, HashAble]{Key: obj.GetKey(), Value: obj}
+	}
+	return pairs
+}
 
 // Get returns the value associated with a key in the hashTable,
 // and an boolean indicating whether the value exists or not.
 func (hm *HashTable) Get(studentId string) (*node, bool) {
-	hm.lock.RLock()
-	defer hm.lock.RUnlock()
-
-	val, found := hm.tree.Search(studentId)
-	if !found || val == nil {
+	value, version, found := hm.HashTable.GetVersioned(studentId)
+	if !found {
 		return nil, false
 	}
-	index := (*val).(uint64)
-	chain := hm.buckets[index]
-	for _, node := range chain {
-		if node.Value.GetKey() == studentId {
-			return &node, true
-		}
-	}
-	return nil, false
+	return &node{Value: value, Version: version}, true
 }
 
-// Delete deletes the Node associated with a key in the hashTable,
-// and an boolean indicating whether the it was successfully deleted
-// or not.
-func (hm *HashTable) Delete(studentId string) (deleted bool) {
-	hm.lock.Lock()
-	defer hm.lock.Unlock()
+// CompareAndSet sets the object if the node of its key is still at
+// expectedVersion, 0 meaning there is none, and returns the new version.
+// Otherwise it returns a *ConflictError.
+func (hm *HashTable) CompareAndSet(obj HashAble, expectedVersion uint64) (uint64, error) {
+	return hm.HashTable.CompareAndSet(obj.GetKey(), obj, expectedVersion)
+}
 
-	ind, deleted := hm.tree.Delete(studentId)
-	if !deleted || *ind == nil {
-		return false
-	}
-	index := (*ind).(uint64)
-	chain := hm.buckets[index]
-	for i, node := range chain {
-		if node.Value.GetKey() == studentId {
-			hm.buckets[index] = append(chain[:i], chain[i+1:]...)
-			return true
-		}
-	}
-	return false
+// Rekey moves the node of oldKey to the key of obj, setting obj as its
+// value, and returns the new version, see generic.HashTable.Rekey. It
+// fails if oldKey doesn't exist or the key of obj is taken.
+func (hm *HashTable) Rekey(oldKey string, obj HashAble) (uint64, error) {
+	return hm.HashTable.Rekey(oldKey, obj.GetKey(), obj)
 }
 
-// GetKeysWithPrefix returns all keys exiting with a given prefix
-func (hm *HashTable) GetKeysWithPrefix(studentId string) []string {
-	hm.lock.RLock()
-	defer hm.lock.RUnlock()
+// Tx is a transaction of Update, see generic.Tx.
+type Tx struct {
+	*generic.Tx[string, HashAble]
+}
 
-	keys := hm.tree.GetPrefixKeys(studentId)
-	return keys
+// Update runs fn in a transaction and commits its changes atomically if
+// fn returns nil, see generic.HashTable.Update.
+func (hm *HashTable) Update(fn func(tx *Tx) error) error {
+	return hm.HashTable.Update(func(tx *generic.Tx[string, HashAble]) error {
+		return fn(&Tx{Tx: tx})
+	})
 }
 
-type pair struct {
-	Key string
-	Value HashAble
+// Set sets the value for an associated key.
+// given object should implements HashAble interface.
+func (tx *Tx) Set(obj HashAble) {
+	tx.Tx.Set(obj.GetKey(), obj)
 }
 
+// Get returns the value associated with a key as the transaction sees
+// it, and an boolean indicating whether the value exists or not.
+func (tx *Tx) Get(studentId string) (*node, bool) {
+	value, found := tx.Tx.Get(studentId)
+	if !found {
+		return nil, false
+	}
+	return &node{Value: value}, true
+}
 
-func (hm *HashTable) GetPairsWithPrefix(pref string) []pair {
-	hm.lock.RLock()
-	defer hm.lock.RUnlock()
+// ShardedHashTable is a HashTable split into shards that are locked
+// independently, see generic.ShardedHashTable.
+type ShardedHashTable struct {
+	*generic.ShardedHashTable[string, HashAble]
+}
 
-	res := hm.GetKeysWithPrefix(pref)
-	pairs := make([]pair, 0)
-	for _, re := range res {
-		elem, found := hm.Get(re)
-		if found {
-			pairs = append(
-				pairs,
-				pair{re, elem.Value},
-			)
-		}
+// NewShardedHashTable returns a hashtable of the given number of shards,
+// splitting size buckets evenly between them.
+func NewShardedHashTable(shards, size int, opts ...Option) (*ShardedHashTable, error) {
+	opts = append([]Option{generic.WithValueHash(HashAble.ToHash), WithPrefixIndex(newTrie)}, opts...)
+	t, err := generic.NewShardedHashTable[string, HashAble](shards, size, nil, opts...)
+	if err != nil {
+		return nil, err
 	}
-	return pairs
+	return &ShardedHashTable{ShardedHashTable: t}, nil
+}
+
+// Set sets the value for an associated key in the hashmap.
+// given object should implements HashAble interface. A key the prefix
+// index doesn't accept is rejected with an error.
+func (st *ShardedHashTable) Set(obj HashAble) (uint64, error) {
+	return st.ShardedHashTable.Set(obj.GetKey(), obj)
 }
 
-func (hm *HashTable) GetAllPairs() []pair {
-	hm.lock.RLock()
-	defer hm.lock.RUnlock()
-
-	res := hm.GetAllKeys()
-	pairs := make([]pair, 0)
-	for _, re := range res {
-		elem, found := hm.Get(re)
-		if found {
-			pairs = append(
-				pairs,
-				pair{re, elem.Value},
-			)
-		}
+// Get returns the value associated with a key in the hashTable,
+// and an boolean indicating whether the value exists or not.
+func (st *ShardedHashTable) Get(studentId string) (*node, bool) {
+	value, found := st.ShardedHashTable.Get(studentId)
+	if !found {
+		return nil, false
 	}
-	return pairs
+	return &node{Value: value}, true
 }
@@ -0,0 +1,12 @@
+// Package hooks seals the seam between package generic and package
+// storage. HashTable.Hooks takes a Seal, and only the packages of this
+// module can import hooks to make one, so only they reach the methods a
+// Store uses to log a change under the lock of the table, after the table
+// checked the change and before it applies it.
+package hooks
+
+// Seal is the argument of HashTable.Hooks. Its blank field keeps a
+// struct literal of another package from converting to it.
+type Seal struct {
+	_ struct{}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import "time"
+
+// SyncPolicy decides when appended log records are flushed to stable
+// storage with fsync. Records always reach the operating system before a
+// write returns, so only a crash of the machine can lose unsynced ones.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log after every record.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval syncs the log in the background at a fixed interval,
+	// see WithSyncInterval.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system.
+	SyncNever
+)
+
+// config holds the settings a Store is opened with.
+type config struct {
+	sync         SyncPolicy
+	syncInterval time.Duration
+	compactEvery int
+}
+
+func defaultConfig() config {
+	return config{sync: SyncAlways, syncInterval: time.Second}
+}
+
+// Option configures a Store in Open.
+type Option func(*config)
+
+// WithSync sets when the log is synced. The default is SyncAlways.
+func WithSync(policy SyncPolicy) Option {
+	return func(c *config) {
+		c.sync = policy
+	}
+}
+
+// WithSyncInterval syncs the log every d in the background, losing at most
+// the records of the last interval on a machine crash. d must be
+// positive, Open fails otherwise.
+func WithSyncInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.sync = SyncInterval
+		c.syncInterval = d
+	}
+}
+
+// WithCompactEvery makes the store write a snapshot and empty the log
+// after every n records, so the log replayed on Open stays short. Zero
+// leaves compaction to explicit calls of Compact.
+func WithCompactEvery(n int) Option {
+	return func(c *config) {
+		c.compactEvery = n
+	}
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"io"
+	"time"
+)
+
+// Get returns the value associated with a key, see HashTable.Get.
+func (s *Store[K, V]) Get(key K) (V, bool) {
+	return s.table.Get(key)
+}
+
+// GetVersioned returns the value and version of a key, see
+// HashTable.GetVersioned.
+func (s *Store[K, V]) GetVersioned(key K) (V, uint64, bool) {
+	return s.table.GetVersioned(key)
+}
+
+// ExpiresAt returns when the entry of a key expires, see
+// HashTable.ExpiresAt.
+func (s *Store[K, V]) ExpiresAt(key K) (time.Time, bool) {
+	return s.table.ExpiresAt(key)
+}
+
+// GetAllKeys returns all keys of the store, see HashTable.GetAllKeys.
+func (s *Store[K, V]) GetAllKeys() []string {
+	return s.table.GetAllKeys()
+}
+
+// GetAllPairs returns all pairs of the store, see HashTable.GetAllPairs.
+func (s *Store[K, V]) GetAllPairs() []generic.Pair[K, V] {
+	return s.table.GetAllPairs()
+}
+
+// GetKeysWithPrefix returns the keys starting with prefix, see
+// HashTable.GetKeysWithPrefix.
+func (s *Store[K, V]) GetKeysWithPrefix(prefix string) []string {
+	return s.table.GetKeysWithPrefix(prefix)
+}
+
+// GetPairsWithPrefix returns the pairs whose key starts with prefix, see
+// HashTable.GetPairsWithPrefix.
+func (s *Store[K, V]) GetPairsWithPrefix(prefix string) []generic.Pair[K, V] {
+	return s.table.GetPairsWithPrefix(prefix)
+}
+
+// GetByIndex returns the pairs whose value has term in a secondary index,
+// see HashTable.GetByIndex.
+func (s *Store[K, V]) GetByIndex(name, term string) ([]generic.Pair[K, V], error) {
+	return s.table.GetByIndex(name, term)
+}
+
+// GetByIndexPrefix returns the pairs whose value has a term starting with
+// prefix in a secondary index, see HashTable.GetByIndexPrefix.
+func (s *Store[K, V]) GetByIndexPrefix(name, prefix string) ([]generic.Pair[K, V], error) {
+	return s.table.GetByIndexPrefix(name, prefix)
+}
+
+// Query returns a query over the pairs of the store, see HashTable.Query.
+func (s *Store[K, V]) Query() *generic.Query[K, V] {
+	return s.table.Query()
+}
+
+// Range returns the pairs scoring between min and max in an ordered index,
+// see HashTable.Range.
+func (s *Store[K, V]) Range(name string, min, max float64) ([]generic.Pair[K, V], error) {
+	return s.table.Range(name, min, max)
+}
+
+// TopK returns the k highest scoring pairs of an ordered index, see
+// HashTable.TopK.
+func (s *Store[K, V]) TopK(name string, k int) ([]generic.Pair[K, V], error) {
+	return s.table.TopK(name, k)
+}
+
+// Rank returns the position of a key in an ordered index, see
+// HashTable.Rank.
+func (s *Store[K, V]) Rank(name string, key K) (int, bool, error) {
+	return s.table.Rank(name, key)
+}
+
+// Percentile returns the pair at percentile p of an ordered index, see
+// HashTable.Percentile.
+func (s *Store[K, V]) Percentile(name string, p float64) (generic.Pair[K, V], bool, error) {
+	return s.table.Percentile(name, p)
+}
+
+// Watch subscribes to the changes of the keys starting with prefix, see
+// HashTable.Watch.
+func (s *Store[K, V]) Watch(prefix string) (events <-chan generic.Event[K, V], cancel func()) {
+	return s.table.Watch(prefix)
+}
+
+// Now returns the current time of the clock of the table, see
+// HashTable.Now.
+func (s *Store[K, V]) Now() time.Time {
+	return s.table.Now()
+}
+
+// Len returns the number of live entries, see HashTable.Len.
+func (s *Store[K, V]) Len() int {
+	return s.table.Len()
+}
+
+// Size returns the number of buckets, see HashTable.Size.
+func (s *Store[K, V]) Size() int {
+	return s.table.Size()
+}
+
+// LoadFactor returns the number of entries per bucket, see
+// HashTable.LoadFactor.
+func (s *Store[K, V]) LoadFactor() float64 {
+	return s.table.LoadFactor()
+}
+
+// Capacity returns the number of entries the table holds at most, see
+// HashTable.Capacity.
+func (s *Store[K, V]) Capacity() int {
+	return s.table.Capacity()
+}
+
+// Seed returns the seed of the hasher of the table, see HashTable.Seed.
+func (s *Store[K, V]) Seed() uint64 {
+	return s.table.Seed()
+}
+
+// Distribution returns the chain length statistics of the table, see
+// HashTable.Distribution.
+func (s *Store[K, V]) Distribution() generic.Distribution {
+	return s.table.Distribution()
+}
+
+// CacheStats returns the lookup and eviction counts of the table, see
+// HashTable.CacheStats.
+func (s *Store[K, V]) CacheStats() generic.CacheStats {
+	return s.table.CacheStats()
+}
+
+// WriteDOT writes the bucket layout of the table in Graphviz DOT format,
+// see HashTable.WriteDOT.
+func (s *Store[K, V]) WriteDOT(w io.Writer, opts generic.DOTOptions) error {
+	return s.table.WriteDOT(w, opts)
+}
@@ -0,0 +1,541 @@
+// Package storage makes a generic.HashTable durable. Every change is
+// appended to a write-ahead log before it is applied, and the log is
+// compacted into a snapshot of the table from time to time. Opening a
+// store loads the latest snapshot and replays the log on top of it.
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/internal/hooks"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File names within the directory of a store.
+const (
+	snapshotFile = "snapshot"
+	logFile      = "wal"
+)
+
+// Store is a HashTable whose changes are logged to a directory. Reads go
+// straight to the table, changes are logged first, so the store only
+// offers the changes it can log. Changes made to the table passed to Open
+// directly are not persisted.
+type Store[K comparable, V any] struct {
+	table *generic.HashTable[K, V]
+	hooks tableHooks[K, V]
+
+	// lock keeps the log in the order the changes are applied.
+	lock  sync.Mutex
+	dir   string
+	codec generic.Codec[K, V]
+	log   *os.File
+	cfg   config
+	// records counts the records appended since the last compaction.
+	records int
+	// evicted holds the keys the table evicted during the change being
+	// applied, their deletes are logged once it is.
+	evicted []K
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// tableHooks holds the methods of the hooks of a generic.HashTable, see
+// HashTable.Hooks. They call prepare, unless it is nil, with the table
+// locked once a change is checked and before it is applied. If prepare
+// fails, nothing changes and its error is returned.
+type tableHooks[K comparable, V any] interface {
+	Set(key K, value V, prepare func() error) (uint64, error)
+	SetUntil(key K, value V, deadline time.Time, prepare func() error) (uint64, error)
+	Update(fn func(tx *generic.Tx[K, V]) error, prepare func(changes []generic.Change[K, V]) error) error
+	CompareAndSet(key K, value V, expected uint64, prepare func() error) (uint64, error)
+	CompareAndDelete(key K, expected uint64, prepare func() error) error
+	BulkSet(pairs []generic.Pair[K, V], sorted bool, prepare func(accepted []generic.Pair[K, V]) error) ([]generic.SetResult, error)
+	Rekey(oldKey, newKey K, value V, prepare func() error) (uint64, error)
+	OnEvict(fn func(K))
+	SuspendEviction(suspend bool)
+	Contains(key K) bool
+}
+
+// Open opens the store in dir, creating the directory if needed, and
+// loads its content into table, which should be empty. Keys and values are
+// encoded by codec.
+//
+// The entries a table with a capacity evicts are logged as deletes, so it
+// evicts nothing while the store is loaded and holds the same entries
+// after a restart. Which entry it evicts next may differ, as the reads
+// that marked entries as used aren't logged.
+func Open[K comparable, V any](dir string, table *generic.HashTable[K, V], codec generic.Codec[K, V], opts ...Option) (*Store[K, V], error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.sync == SyncInterval && cfg.syncInterval <= 0 {
+		return nil, errors.New("sync interval should be > 0")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store[K, V]{table: table, dir: dir, codec: codec, cfg: cfg}
+	s.hooks = table.Hooks(hooks.Seal{}).(tableHooks[K, V])
+
+	// Resuming evicts down to the capacity, in case it shrank since the
+	// store was written; those evictions are logged with the next change.
+	s.hooks.SuspendEviction(true)
+	defer s.hooks.SuspendEviction(false)
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.records, err = replay(f, s.apply)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("replaying %s: %w", f.Name(), err)
+	}
+	s.log = f
+	s.hooks.OnEvict(func(key K) { s.evicted = append(s.evicted, key) })
+
+	if cfg.sync == SyncInterval {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// loadSnapshot loads the snapshot of the store into the table, if there
+// is one.
+func (s *Store[K, V]) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.table.LoadSnapshot(f, s.codec); err != nil {
+		return fmt.Errorf("loading %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// apply applies a replayed log record to the table.
+func (s *Store[K, V]) apply(op byte, payload []byte) error {
+	if op == opBatch {
+		return decodeBatch(payload, s.apply)
+	}
+	var deadline int64
+	if op == opSetUntil {
+		if len(payload) < 8 {
+			return errors.New("truncated expiring set record")
+		}
+		deadline = int64(binary.LittleEndian.Uint64(payload))
+		payload = payload[8:]
+	}
+	key, value, err := s.codec.Decode(payload)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case opSet:
+		_, err = s.table.Set(key, value)
+	case opSetUntil:
+		// An entry expired since is set all the same and removed later,
+		// so replaying gives every entry the same version.
+		_, err = s.table.SetUntil(key, value, time.Unix(0, deadline))
+	case opDelete:
+		s.table.Delete(key)
+	default:
+		return fmt.Errorf("unknown log operation %d", op)
+	}
+	return err
+}
+
+// syncLoop syncs the log every interval until Close.
+func (s *Store[K, V]) syncLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.lock.Lock()
+			_ = s.log.Sync()
+			s.lock.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// append writes a record to the log, syncing it as the policy requires.
+// The caller must hold the lock.
+func (s *Store[K, V]) append(op byte, key K, value V) error {
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+	payload, err := s.codec.Encode(key, value)
+	if err != nil {
+		return err
+	}
+	return s.write(op, payload)
+}
+
+// appendBatch writes the changes of a transaction to the log as a single
+// record. The caller must hold the lock.
+func (s *Store[K, V]) appendBatch(changes []generic.Change[K, V]) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	ops := make([]byte, len(changes))
+	payloads := make([][]byte, len(changes))
+	for i, c := range changes {
+		ops[i] = opSet
+		if c.Deleted {
+			ops[i] = opDelete
+		}
+		payload, err := s.codec.Encode(c.Key, c.Value)
+		if err != nil {
+			return err
+		}
+		payloads[i] = payload
+	}
+	return s.write(opBatch, encodeBatch(ops, payloads))
+}
+
+// write appends a record to the log and syncs it as the policy requires.
+// The caller must hold the lock.
+func (s *Store[K, V]) write(op byte, payload []byte) error {
+	end, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = s.log.Write(encodeRecord(op, payload))
+	if err == nil && s.cfg.sync == SyncAlways {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// The change isn't applied, so drop any part of its record that
+		// made it to the log, or replay would stop there.
+		_ = s.log.Truncate(end)
+		_, _ = s.log.Seek(end, io.SeekStart)
+		return err
+	}
+	s.records++
+	return nil
+}
+
+// maybeCompact logs the evictions of the change just applied, then
+// compacts the store once enough records were appended. The caller must
+// hold the lock.
+func (s *Store[K, V]) maybeCompact() error {
+	if err := s.logEvictions(); err != nil {
+		return err
+	}
+	if s.cfg.compactEvery <= 0 || s.records < s.cfg.compactEvery {
+		return nil
+	}
+	return s.compact()
+}
+
+// logEvictions logs a delete for every key the table evicted since the
+// last call and doesn't hold anymore: a change of several keys may evict
+// one it sets again later. The evictions are applied already, so if
+// logging fails, the keys come back when the store is reopened, and the
+// table evicts down to its capacity again. The caller must hold the lock.
+func (s *Store[K, V]) logEvictions() error {
+	evicted := s.evicted
+	s.evicted = nil
+	for _, key := range evicted {
+		if s.hooks.Contains(key) {
+			continue
+		}
+		if err := s.append(opDelete, key, *new(V)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set logs and sets the value for an associated key. Nothing is logged
+// for a key the table rejects, see HashTable.Set, and the table is left
+// unchanged if logging fails.
+func (s *Store[K, V]) Set(key K, value V) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.hooks.Set(key, value, func() error {
+		return s.append(opSet, key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// SetWithTTL logs and sets the value for an associated key, which expires
+// once ttl has passed on the clock of the table, see
+// HashTable.SetWithTTL. The deadline is logged, so the entry expires at
+// the same time after a restart.
+func (s *Store[K, V]) SetWithTTL(key K, value V, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.Set(key, value)
+	}
+	return s.SetUntil(key, value, s.table.Now().Add(ttl))
+}
+
+// SetUntil logs and sets the value for an associated key, which expires
+// at deadline, see HashTable.SetUntil.
+func (s *Store[K, V]) SetUntil(key K, value V, deadline time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.hooks.SetUntil(key, value, deadline, func() error {
+		if s.log == nil {
+			return errors.New("store is closed")
+		}
+		payload, err := s.codec.Encode(key, value)
+		if err != nil {
+			return err
+		}
+		record := make([]byte, 8, 8+len(payload))
+		binary.LittleEndian.PutUint64(record, uint64(deadline.UnixNano()))
+		return s.write(opSetUntil, append(record, payload...))
+	})
+	if err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// Delete logs and deletes the entry associated with a key, and reports
+// whether it existed.
+func (s *Store[K, V]) Delete(key K) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Contains doesn't count as a lookup of the key, nor as a use of it.
+	if !s.hooks.Contains(key) {
+		return false, nil
+	}
+	if err := s.append(opDelete, key, *new(V)); err != nil {
+		return false, err
+	}
+	deleted := s.table.Delete(key)
+	return deleted, s.maybeCompact()
+}
+
+// SetMany logs the pairs the table accepts as a single record and sets
+// them, see HashTable.SetMany. Nothing is set if logging fails.
+func (s *Store[K, V]) SetMany(pairs []generic.Pair[K, V]) ([]generic.SetResult, error) {
+	return s.bulkSet(pairs, false)
+}
+
+// LoadSorted is SetMany for pairs sorted by key, see HashTable.LoadSorted.
+func (s *Store[K, V]) LoadSorted(pairs []generic.Pair[K, V]) ([]generic.SetResult, error) {
+	return s.bulkSet(pairs, true)
+}
+
+func (s *Store[K, V]) bulkSet(pairs []generic.Pair[K, V], sorted bool) ([]generic.SetResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.log == nil {
+		return nil, errors.New("store is closed")
+	}
+	results, err := s.hooks.BulkSet(pairs, sorted, func(accepted []generic.Pair[K, V]) error {
+		changes := make([]generic.Change[K, V], len(accepted))
+		for i, p := range accepted {
+			changes[i] = generic.Change[K, V]{Key: p.Key, Value: p.Value}
+		}
+		return s.appendBatch(changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, s.maybeCompact()
+}
+
+// CompareAndSet logs and sets the value for key if its version is still
+// expected, see HashTable.CompareAndSet, and returns the new version.
+// Nothing is logged on a conflict.
+func (s *Store[K, V]) CompareAndSet(key K, value V, expected uint64) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version, err := s.hooks.CompareAndSet(key, value, expected, func() error {
+		return s.append(opSet, key, value)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, s.maybeCompact()
+}
+
+// CompareAndDelete logs and deletes the entry of key if its version is
+// still expected, see HashTable.CompareAndDelete.
+func (s *Store[K, V]) CompareAndDelete(key K, expected uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.hooks.CompareAndDelete(key, expected, func() error {
+		return s.append(opDelete, key, *new(V))
+	})
+	if err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// Rekey logs and moves the entry of oldKey to newKey, see HashTable.Rekey,
+// and returns its new version. The move is logged as a single record and
+// replayed all or none. Nothing is logged if the move fails its checks.
+func (s *Store[K, V]) Rekey(oldKey, newKey K, value V) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.log == nil {
+		return 0, errors.New("store is closed")
+	}
+	version, err := s.hooks.Rekey(oldKey, newKey, value, func() error {
+		changes := []generic.Change[K, V]{{Key: oldKey, Deleted: true}, {Key: newKey, Value: value}}
+		if oldKey == newKey {
+			changes = changes[1:]
+		}
+		return s.appendBatch(changes)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, s.maybeCompact()
+}
+
+// Update runs fn in a transaction of the table, see HashTable.Update, and
+// logs its changes as a single record before committing them. They are
+// replayed all or none. Nothing is logged for a transaction the table
+// rejects, and if logging fails, the transaction rolls back.
+func (s *Store[K, V]) Update(fn func(tx *generic.Tx[K, V]) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+	err := s.hooks.Update(fn, s.appendBatch)
+	if err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// Compact writes a snapshot of the table and empties the log.
+func (s *Store[K, V]) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.compact()
+}
+
+// compact writes the snapshot to a temporary file and renames it over the
+// old one, so a crash leaves either snapshot intact. The log is emptied
+// only after that; replaying it over the new snapshot is harmless. The
+// caller must hold the lock.
+func (s *Store[K, V]) compact() error {
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+	path := filepath.Join(s.dir, snapshotFile)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	err = s.table.WriteSnapshot(w, s.codec)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.records = 0
+	return s.log.Sync()
+}
+
+// syncDir syncs a directory, making renames within it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Sync flushes the log to stable storage.
+func (s *Store[K, V]) Sync() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+	return s.log.Sync()
+}
+
+// Close syncs and closes the log and stops the janitor of the table. The
+// table stays readable, but further changes through the store fail.
+func (s *Store[K, V]) Close() error {
+	s.table.Close()
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.logEvictions()
+	if serr := s.log.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	s.log = nil
+	s.hooks.OnEvict(nil)
+	return err
+}
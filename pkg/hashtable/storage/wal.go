@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Log record operations.
+const (
+	opSet    byte = 1
+	opDelete byte = 2
+	// opBatch holds the records of a transaction, which are replayed
+	// all or none.
+	opBatch byte = 3
+	// opSetUntil is an opSet whose entry expires, its payload starts with
+	// the deadline in Unix nanoseconds.
+	opSetUntil byte = 4
+)
+
+// recordHeader is the size of the header of a log record: a CRC-32 of the
+// rest of the record, the payload length and the operation.
+const recordHeader = 4 + 4 + 1
+
+// maxRecord bounds the payload length read from the log, so a corrupted
+// length doesn't make replay allocate gigabytes.
+const maxRecord = 1 << 30
+
+// errTorn reports a record cut short or failing its checksum.
+var errTorn = errors.New("torn log record")
+
+// encodeRecord returns the log record of op with the given payload. Its
+// layout is crc32 | length | op | payload, integers little endian, the
+// checksum covering everything after it.
+func encodeRecord(op byte, payload []byte) []byte {
+	rec := make([]byte, recordHeader+len(payload))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(len(payload)))
+	rec[8] = op
+	copy(rec[recordHeader:], payload)
+	binary.LittleEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+	return rec
+}
+
+// encodeBatch returns the payload of an opBatch record holding the given
+// operations and their payloads: op | length | payload for each of them.
+func encodeBatch(ops []byte, payloads [][]byte) []byte {
+	size := 0
+	for _, p := range payloads {
+		size += 1 + 4 + len(p)
+	}
+	batch := make([]byte, 0, size)
+	for i, p := range payloads {
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(p)))
+		batch = append(batch, ops[i])
+		batch = append(batch, length[:]...)
+		batch = append(batch, p...)
+	}
+	return batch
+}
+
+// decodeBatch calls fn for every operation of an opBatch payload.
+func decodeBatch(batch []byte, fn func(op byte, payload []byte) error) error {
+	for len(batch) > 0 {
+		if len(batch) < 5 {
+			return errors.New("truncated batch record")
+		}
+		op, length := batch[0], binary.LittleEndian.Uint32(batch[1:])
+		batch = batch[5:]
+		if uint64(length) > uint64(len(batch)) {
+			return errors.New("truncated batch record")
+		}
+		if err := fn(op, batch[:length]); err != nil {
+			return err
+		}
+		batch = batch[length:]
+	}
+	return nil
+}
+
+// readRecord reads the next record from r. It returns io.EOF at the clean
+// end of the log and errTorn for an incomplete or corrupted record.
+func readRecord(r *bufio.Reader) (op byte, payload []byte, size int64, err error) {
+	var header [recordHeader]byte
+	n, err := io.ReadFull(r, header[:])
+	if err == io.EOF {
+		return 0, nil, 0, io.EOF
+	}
+	if err != nil || n < recordHeader {
+		return 0, nil, 0, errTorn
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	if length > maxRecord {
+		return 0, nil, 0, errTorn
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, 0, errTorn
+	}
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[4:])
+	_, _ = crc.Write(payload)
+	if crc.Sum32() != binary.LittleEndian.Uint32(header[:]) {
+		return 0, nil, 0, errTorn
+	}
+	return header[8], payload, int64(recordHeader) + int64(length), nil
+}
+
+// replay calls apply for every intact record of the log in f and
+// truncates the log after the last one. A crash while appending leaves a
+// torn record at the end, which is dropped that way. It returns the
+// number of records applied.
+func replay(f *os.File, apply func(op byte, payload []byte) error) (int, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var good int64
+	records := 0
+	for {
+		op, payload, size, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err == errTorn {
+			if err := f.Truncate(good); err != nil {
+				return records, err
+			}
+			break
+		}
+		if err := apply(op, payload); err != nil {
+			return records, err
+		}
+		good += size
+		records++
+	}
+	_, err := f.Seek(good, io.SeekStart)
+	return records, err
+}
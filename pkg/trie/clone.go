@@ -0,0 +1,92 @@
+package trie
+
+import "unsafe"
+
+// Clone returns a deep copy of the trie. Every node is copied, and values
+// are passed through copyValue so callers can deep-copy them as well. A nil
+// copyValue shares the values between both tries.
+func (t *Trie) Clone(copyValue func(value interface{}) interface{}) *Trie {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	clone := NewTrie()
+	clone.size = t.size
+
+	type pair struct {
+		src, dst *Node
+	}
+	stack := []pair{{src: t.root, dst: clone.root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.src.Value != nil {
+			if copyValue != nil {
+				top.dst.Value = copyValue(top.src.Value)
+			} else {
+				top.dst.Value = top.src.Value
+			}
+		}
+		for i, child := range top.src.children {
+			if child == nil {
+				continue
+			}
+			top.dst.children[i] = newNode(child.symbol, top.dst)
+			stack = append(stack, pair{src: child, dst: top.dst.children[i]})
+		}
+	}
+	return clone
+}
+
+// Equal reports whether both tries hold the same keys with equal values.
+// The tries are compared node by node; valueEq decides whether two values
+// are equal, a nil valueEq compares them with ==.
+func (t *Trie) Equal(other *Trie, valueEq func(a, b interface{}) bool) bool {
+	if t == other {
+		return true
+	}
+	if valueEq == nil {
+		valueEq = func(a, b interface{}) bool { return a == b }
+	}
+
+	// Lock both tries in address order, or a.Equal(b) and b.Equal(a)
+	// could each wait for the other behind a pending writer.
+	first, second := t, other
+	if uintptr(unsafe.Pointer(second)) < uintptr(unsafe.Pointer(first)) {
+		first, second = second, first
+	}
+	first.rw.RLock()
+	defer first.rw.RUnlock()
+	second.rw.RLock()
+	defer second.rw.RUnlock()
+
+	if t.size != other.size {
+		return false
+	}
+
+	type pair struct {
+		a, b *Node
+	}
+	stack := []pair{{a: t.root, b: other.root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if (top.a.Value == nil) != (top.b.Value == nil) {
+			return false
+		}
+		if top.a.Value != nil && !valueEq(top.a.Value, top.b.Value) {
+			return false
+		}
+		for i, child := range top.a.children {
+			switch otherChild := top.b.children[i]; {
+			case child == nil && otherChild == nil:
+			case child == nil || otherChild == nil:
+				return false
+			default:
+				stack = append(stack, pair{a: child, b: otherChild})
+			}
+		}
+	}
+	return true
+}
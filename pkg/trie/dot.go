@@ -0,0 +1,98 @@
+package trie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DOTOptions controls which part of a Trie WriteDOT renders.
+type DOTOptions struct {
+	// Prefix restricts the graph to the subtree below the given key.
+	// An empty prefix renders the whole trie.
+	Prefix string
+	// MaxDepth limits how many levels below the start node are drawn.
+	// Cut off subtrees are drawn as a single "..." node. Zero means no
+	// limit.
+	MaxDepth int
+}
+
+// WriteDOT writes the structure of the trie to w in Graphviz DOT format.
+// Every node is labeled with its symbol and nodes holding a value are
+// drawn as double circles with the value next to them.
+func (t *Trie) WriteDOT(w io.Writer, opts DOTOptions) error {
+	prefix := convert(opts.Prefix)
+
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph trie {")
+	fmt.Fprintln(bw, "\tnode [shape=circle];")
+
+	start := t.find(prefix)
+	if start != nil {
+		writeDOTNodes(bw, start, opts)
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// writeDOTNodes emits start and its descendants using an explicit stack.
+func writeDOTNodes(w io.Writer, start *Node, opts DOTOptions) {
+	type item struct {
+		node  *Node
+		id    int
+		depth int
+	}
+
+	nextID := 0
+	label := "root"
+	if !start.root {
+		label = opts.Prefix
+	}
+	writeDOTNode(w, nextID, label, start)
+	stack := []item{{node: start, id: nextID}}
+	nextID++
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if opts.MaxDepth > 0 && top.depth == opts.MaxDepth {
+			if hasChildren(top.node) {
+				fmt.Fprintf(w, "\tn%d [label=\"...\", shape=plaintext];\n", nextID)
+				fmt.Fprintf(w, "\tn%d -> n%d;\n", top.id, nextID)
+				nextID++
+			}
+			continue
+		}
+
+		children := make([]item, 0, len(top.node.children))
+		for _, child := range top.node.children {
+			if child == nil {
+				continue
+			}
+			writeDOTNode(w, nextID, string(child.symbol+zeroAscii), child)
+			fmt.Fprintf(w, "\tn%d -> n%d;\n", top.id, nextID)
+			children = append(children, item{node: child, id: nextID, depth: top.depth + 1})
+			nextID++
+		}
+
+		// Push children in reverse so they are expanded in symbol order.
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
+	}
+}
+
+func writeDOTNode(w io.Writer, id int, label string, n *Node) {
+	if n.Value == nil {
+		fmt.Fprintf(w, "\tn%d [label=%s];\n", id, strconv.Quote(label))
+		return
+	}
+	fmt.Fprintf(w, "\tn%d [label=%s, shape=doublecircle, xlabel=%s];\n",
+		id, strconv.Quote(label), strconv.Quote(fmt.Sprint(n.Value)))
+}
@@ -0,0 +1,39 @@
+package trie
+
+// PrefixIndex is an ordered string index that supports prefix queries.
+// It holds what a HashTable needs to map keys to bucket indexes, so
+// different tree implementations can be swapped in and compared.
+type PrefixIndex interface {
+	// Insert inserts a key value pair. If the key already exists, the
+	// value is updated.
+	Insert(key string, value interface{})
+	// Upsert atomically inserts or updates the value of key based on
+	// its current value, see Trie.Upsert.
+	Upsert(key string, fn func(old interface{}, exists bool) (interface{}, bool)) (interface{}, bool)
+	// LoadOrStore returns the value of key if present, otherwise it
+	// stores value.
+	LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool)
+	// LoadOrStoreMany does LoadOrStore for many keys under a single
+	// lock, see Trie.LoadOrStoreMany.
+	LoadOrStoreMany(keys []string, values []interface{}) (actual []interface{}, loaded []bool)
+	// Accepts reports whether key can be stored in the index.
+	Accepts(key string) bool
+	// Search returns the value stored for key.
+	Search(key string) (*interface{}, bool)
+	// Delete removes key and returns the value it held.
+	Delete(key string) (*interface{}, bool)
+	// GetPrefixKeys returns all keys starting with prefix in order.
+	GetPrefixKeys(prefix string) []string
+	// Walk calls fn for every key starting with prefix and its value in
+	// order, until fn returns false.
+	Walk(prefix string, fn func(key string, value interface{}) bool)
+	// GetAllKeys returns all keys in order.
+	GetAllKeys() []string
+	// Size returns the number of keys in the index.
+	Size() int
+}
+
+var (
+	_ PrefixIndex = (*Trie)(nil)
+	_ PrefixIndex = (*TernaryTree)(nil)
+)
@@ -0,0 +1,93 @@
+package trie
+
+import "strings"
+
+// frame is a single level of the iterator's explicit stack. next is the
+// index of the next child to visit, or -1 if the node itself has not been
+// reported yet.
+type frame struct {
+	node *Node
+	next int
+}
+
+// iterator walks a subtree in lexicographic order without recursion.
+// The key of the current node is kept in a single buffer that grows and
+// shrinks with the stack, so no per-node slices are allocated.
+type iterator struct {
+	stack []frame
+	key   Bytes
+	base  int
+	curr  *Node
+	sb    strings.Builder
+}
+
+// newIterator returns an iterator over the subtree rooted at start. prefix
+// is the key of start itself; it is copied into the key buffer.
+func newIterator(start *Node, prefix Bytes) *iterator {
+	it := &iterator{}
+	it.reset(start, prefix)
+	return it
+}
+
+func (it *iterator) reset(start *Node, prefix Bytes) {
+	it.stack = it.stack[:0]
+	it.key = append(it.key[:0], prefix...)
+	it.base = len(prefix)
+	it.curr = nil
+	if start != nil {
+		it.stack = append(it.stack, frame{node: start, next: -1})
+	}
+}
+
+// next advances to the next node holding a value and reports whether
+// there was one.
+func (it *iterator) next() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.next < 0 {
+			top.next = 0
+			if top.node.Value != nil {
+				it.curr = top.node
+				return true
+			}
+		}
+
+		var child *Node
+		for top.next < len(top.node.children) {
+			child = top.node.children[top.next]
+			top.next++
+			if child != nil {
+				break
+			}
+			child = nil
+		}
+
+		if child != nil {
+			it.stack = append(it.stack, frame{node: child, next: -1})
+			it.key = append(it.key, child.symbol)
+			continue
+		}
+
+		it.stack = it.stack[:len(it.stack)-1]
+		if len(it.stack) > 0 {
+			it.key = it.key[:it.base+len(it.stack)-1]
+		}
+	}
+	it.curr = nil
+	return false
+}
+
+// value returns the value of the current node.
+func (it *iterator) value() interface{} {
+	return it.curr.Value
+}
+
+// keyString returns the key of the current node in its textual form.
+func (it *iterator) keyString() string {
+	it.sb.Reset()
+	it.sb.Grow(len(it.key))
+	for _, b := range it.key {
+		it.sb.WriteByte(b + zeroAscii)
+	}
+	return it.sb.String()
+}
@@ -39,7 +39,7 @@ func newNode(symbol byte, parent *Node) *Node {
 	return &Node{children: make([]*Node, 10), symbol: symbol, parent: parent}
 }
 
-// Size returns the total number of nodes in the trie.
+// Size returns the number of keys in the trie.
 func (t *Trie) Size() int {
 	t.rw.RLock()
 	defer t.rw.RUnlock()
@@ -47,15 +47,15 @@ func (t *Trie) Size() int {
 }
 
 func convert(s string) Bytes {
-	var bs Bytes
+	bs := make(Bytes, len(s))
 	for i := 0; i < len(s); i++ {
-		bs = append(bs, s[i] - byte('0'))
+		bs[i] = s[i] - zeroAscii
 	}
 	return bs
 }
 
 // Insert inserts a key Value pair into the trie. If the key already exists,
-// the Value is updated.
+// the Value is updated. Inserting a nil Value deletes the key.
 func (t *Trie) Insert(sKey string, value interface{}) {
 	key := convert(sKey)
 	t.rw.Lock()
@@ -64,6 +64,18 @@ func (t *Trie) Insert(sKey string, value interface{}) {
 		return
 	}
 
+	if value == nil {
+		if n := t.find(key); n != nil && n.Value != nil {
+			t.remove(n)
+		}
+		return
+	}
+	t.store(t.insertPath(key), value)
+}
+
+// insertPath returns the node for key, creating the missing nodes on the
+// way. The caller must hold the write lock.
+func (t *Trie) insertPath(key Bytes) *Node {
 	currNode := t.root
 
 	for _, sym := range key {
@@ -74,59 +86,164 @@ func (t *Trie) Insert(sKey string, value interface{}) {
 
 		currNode = currNode.children[symbol]
 	}
+	return currNode
+}
 
+// store sets the Value of n. The caller must hold the write lock.
+func (t *Trie) store(n *Node, value interface{}) {
 	// Only increase size if the key Value pair is new, otherwise we consider
 	// the operation as an update.
-	if currNode.Value == nil {
+	if n.Value == nil && value != nil {
 		t.size++
 	}
 
-	currNode.Value = value
+	n.Value = value
 }
 
-func (t *Trie) Delete(sKey string) (value *interface{}, deleted bool) {
+// Upsert atomically inserts or updates the Value of a key. fn receives the
+// current Value and whether the key exists, and returns the new Value and
+// whether it should be stored; if not, the trie is left unchanged. Storing
+// a nil Value deletes the key. Upsert returns the Value held by the key
+// afterwards and whether fn's Value was stored.
+//
+// fn is called with the trie locked, so it must not access the trie.
+func (t *Trie) Upsert(sKey string, fn func(old interface{}, exists bool) (interface{}, bool)) (interface{}, bool) {
 	key := convert(sKey)
-	t.rw.RLock()
-	defer t.rw.RUnlock()
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	if len(key) == 0 {
+		return nil, false
+	}
 
-	currNode := t.root
+	var old interface{}
+	currNode := t.find(key)
+	if currNode != nil {
+		old = currNode.Value
+	}
 
-	for _, symbol := range key {
-		if currNode.children[symbol] == nil {
-			return nil, false
+	value, ok := fn(old, old != nil)
+	switch {
+	case !ok:
+		return old, false
+	case value == nil:
+		if old != nil {
+			t.remove(currNode)
 		}
-		currNode = currNode.children[symbol]
+	case currNode == nil:
+		t.store(t.insertPath(key), value)
+	default:
+		t.store(currNode, value)
 	}
+	return value, true
+}
 
-	if currNode.Value != nil {
-		t.size--
-	}
+// LoadOrStore returns the existing Value of the key if present. Otherwise,
+// it stores and returns the given Value. The loaded result is true if the
+// Value was loaded, false if stored.
+func (t *Trie) LoadOrStore(sKey string, value interface{}) (actual interface{}, loaded bool) {
+	actual, _ = t.Upsert(sKey, func(old interface{}, exists bool) (interface{}, bool) {
+		loaded = exists
+		return value, !exists
+	})
+	return actual, loaded
+}
 
-	pTmpValue := currNode.Value
-	parent := currNode.parent
-	currNode.Value = nil
+// LoadOrStoreMany does LoadOrStore for every key and the value at the
+// same position, in order, under a single lock. Every key starts from the
+// deepest node it shares with the key before it, so sorted keys build
+// each node of the trie exactly once.
+func (t *Trie) LoadOrStoreMany(sKeys []string, values []interface{}) (actual []interface{}, loaded []bool) {
+	actual = make([]interface{}, len(sKeys))
+	loaded = make([]bool, len(sKeys))
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	// path holds the nodes of the previous key, the root first.
+	path := []*Node{t.root}
+	var prev Bytes
+	for i, sKey := range sKeys {
+		key := convert(sKey)
+		if len(key) == 0 {
+			continue
+		}
+		shared := 0
+		for shared < len(prev) && shared < len(key) && prev[shared] == key[shared] {
+			shared++
+		}
+		path = path[:shared+1]
+		currNode := path[shared]
+		for _, symbol := range key[shared:] {
+			if currNode.children[symbol] == nil {
+				currNode.children[symbol] = newNode(symbol, currNode)
+			}
+			currNode = currNode.children[symbol]
+			path = append(path, currNode)
+		}
+		prev = key
+
+		if currNode.Value != nil {
+			actual[i], loaded[i] = currNode.Value, true
+			continue
+		}
+		t.store(currNode, values[i])
+		actual[i] = values[i]
+	}
+	return actual, loaded
+}
 
-	for !hasChildren(parent.children){
-		if parent.root {
-			break
+// Accepts reports whether key can be stored in the trie, which only takes
+// non-empty keys of decimal digits.
+func (t *Trie) Accepts(sKey string) bool {
+	if len(sKey) == 0 {
+		return false
+	}
+	for i := 0; i < len(sKey); i++ {
+		if sKey[i] < '0' || sKey[i] > '9' {
+			return false
 		}
-		tmpPar := parent.parent
-		parent = &Node{}
-		parent = tmpPar
 	}
+	return true
+}
 
+// Delete removes a key from the trie and returns the value it held. Nodes
+// left without a value or children are pruned, so the trie only keeps the
+// paths of existing keys.
+func (t *Trie) Delete(sKey string) (value *interface{}, deleted bool) {
+	key := convert(sKey)
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	currNode := t.find(key)
+	if currNode == nil || currNode.Value == nil || currNode.root {
+		return nil, false
+	}
+
+	pTmpValue := currNode.Value
+	t.remove(currNode)
 	return &pTmpValue, true
 }
 
-func hasChildren(nodes []*Node) bool {
-	hasChildren := false
-	for _, node := range nodes {
-		if node != nil && node.Value != nil{
-			hasChildren = true
-			break
+// remove clears the Value of n and prunes the nodes left without a Value
+// or children. The caller must hold the write lock.
+func (t *Trie) remove(n *Node) {
+	t.size--
+	n.Value = nil
+
+	for !n.root && n.Value == nil && !hasChildren(n) {
+		parent := n.parent
+		parent.children[n.symbol] = nil
+		n.parent = nil
+		n = parent
+	}
+}
+
+func hasChildren(n *Node) bool {
+	for _, child := range n.children {
+		if child != nil {
+			return true
 		}
 	}
-	return hasChildren
+	return false
 }
 
 // Search attempts to search for a Value in the trie given a key.
@@ -151,148 +268,85 @@ func (t *Trie) Search(sKey string) (*interface{}, bool) {
 	return &currNode.Value, true
 }
 
+// find returns the node reached by following key from the root, or nil if
+// no such path exists. The caller must hold the lock.
+func (t *Trie) find(key Bytes) *Node {
+	currNode := t.root
+	for _, symbol := range key {
+		if currNode = currNode.children[symbol]; currNode == nil {
+			return nil
+		}
+	}
+	return currNode
+}
+
 // GetAllKeys returns all the keys that exist in the trie. Keys are retrieved
-// by performing a DFS on the trie.
+// in lexicographic order by an iterative DFS on the trie.
 func (t *Trie) GetAllKeys() []string {
-	visited := make(map[*Node]bool)
-	var keys []Bytes
-
-	var dfsGetKeys func(n *Node, key Bytes)
-	dfsGetKeys = func(n *Node, key Bytes) {
-		if n != nil {
-			pathKey := append(key, n.symbol)
-			visited[n] = true
-
-			if n.Value != nil {
-				fullKey := make(Bytes, len(pathKey))
-
-				// Copy the contents of the current path (key) to a new key so
-				// future recursive calls will contain the correct bytes.
-				copy(fullKey, pathKey)
-
-				// Append the path (key) to the key list ignoring the first
-				// byte which is the root symbol.
-				keys = append(keys, fullKey[1:])
-			}
+	t.rw.RLock()
+	defer t.rw.RUnlock()
 
-			for _, child := range n.children {
-				if _, ok := visited[child]; !ok {
-					dfsGetKeys(child, pathKey)
-				}
-			}
-		}
-	}
-	dfsGetKeys(t.root, Bytes{})
-	var strS []string
-	for _, key := range keys {
-		tmp := ""
-		for _, b := range key {
-			tmp += string(b + zeroAscii)
-		}
-		strS = append(strS, tmp)
+	var keys []string
+	it := newIterator(t.root, nil)
+	for it.next() {
+		keys = append(keys, it.keyString())
 	}
-
-	return strS
+	return keys
 }
 
-// GetPrefixKeys returns all the keys that exist in the trie  Keys are retrieved
-// by performing a DFS on the trie.
+// GetPrefixKeys returns all the keys that exist in the trie with the given
+// prefix, including the prefix itself. Keys are retrieved in lexicographic
+// order by an iterative DFS on the trie.
 func (t *Trie) GetPrefixKeys(sPrefix string) []string {
 	prefix := convert(sPrefix)
-	visited := make(map[*Node]bool)
-	var keys []Bytes
-
 	if len(prefix) == 0 {
 		return []string{}
 	}
 
-	var dfsGetPrefixKeys func(n *Node, prefixIdx int, key Bytes)
-	dfsGetPrefixKeys = func(n *Node, prefixIdx int, key Bytes) {
-		if n != nil {
-			pathKey := append(key, n.symbol)
-
-			if prefixIdx == len(prefix) || n.symbol == (prefix[prefixIdx]) {
-				visited[n] = true
-
-				if n.Value != nil {
-					fullKey := make(Bytes, len(pathKey))
-
-					// Copy the contents of the current path (key) to a new key
-					// so future recursive calls will contain the correct
-					// bytes.
-					copy(fullKey, pathKey)
-					keys = append(keys, fullKey)
-				}
-
-				if prefixIdx < len(prefix) {
-					prefixIdx++
-				}
-				for _, child := range n.children {
-					if child != nil {
-						if _, ok := visited[child]; !ok {
-							dfsGetPrefixKeys(child, prefixIdx, pathKey)
-						}
-					}
-				}
-			}
-		}
-	}
+	t.rw.RLock()
+	defer t.rw.RUnlock()
 
-	// Find starting node from the root's children
-	if n := t.root.children[prefix[0]]; n != nil {
-		dfsGetPrefixKeys(n, 0, Bytes{})
+	var keys []string
+	it := newIterator(t.find(prefix), prefix)
+	for it.next() {
+		keys = append(keys, it.keyString())
 	}
-	var strS []string
-	for _, key := range keys {
-		if len(key) >= len(prefix) {
-			tmp := ""
-			for _, b := range key {
-				tmp += string(b + zeroAscii)
-			}
-			strS = append(strS, tmp)
+	return keys
+}
+
+// Walk calls fn for every key starting with prefix and its value, in
+// lexicographic order, until fn returns false. An empty prefix walks all
+// keys. The trie is read locked during the walk, so fn must not modify it.
+func (t *Trie) Walk(sPrefix string, fn func(key string, value interface{}) bool) {
+	prefix := convert(sPrefix)
+
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	it := newIterator(t.find(prefix), prefix)
+	for it.next() {
+		if !fn(it.keyString(), it.value()) {
+			return
 		}
 	}
-	return strS
 }
 
 // GetPrefixValues returns all the values that exist in the trie with given prefix
-// Values retrieved by performing a DFS on the trie.
+// Values retrieved by performing an iterative DFS on the trie.
 func (t *Trie) GetPrefixValues(sPrefix string) []interface{} {
 	prefix := convert(sPrefix)
-	visited := make(map[*Node]bool)
 	var values []interface{}
 
 	if len(prefix) == 0 {
 		return values
 	}
 
-	var dfsGetPrefixValues func(n *Node, prefixIdx int)
-	dfsGetPrefixValues = func(n *Node, prefixIdx int) {
-		if n != nil {
-			if prefixIdx == len(prefix) || n.symbol == (prefix[prefixIdx]) {
-				visited[n] = true
-
-				if n.Value != nil {
-					values = append(values, n.Value)
-				}
-
-				if prefixIdx < len(prefix) {
-					prefixIdx++
-				}
-
-				for _, child := range n.children {
-					if _, ok := visited[child]; !ok {
-						dfsGetPrefixValues(child, prefixIdx)
-					}
-				}
-			}
-		}
-	}
+	t.rw.RLock()
+	defer t.rw.RUnlock()
 
-	//// Find starting node from the root's children
-	if n := t.root.children[prefix[0]]; n != nil {
-		dfsGetPrefixValues(n, 0)
+	it := newIterator(t.find(prefix), prefix)
+	for it.next() {
+		values = append(values, it.value())
 	}
-
 	return values
 }
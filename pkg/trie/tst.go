@@ -0,0 +1,369 @@
+package trie
+
+import "sync"
+
+type tstNode struct {
+	symbol     byte
+	lo, eq, hi *tstNode
+	value      interface{}
+}
+
+// TernaryTree implements a thread-safe ternary search tree. Unlike Trie it
+// accepts any byte as a key symbol and only allocates the branches that
+// are actually used, trading a few comparisons per symbol for memory.
+type TernaryTree struct {
+	rw   sync.RWMutex
+	root *tstNode
+	size int
+}
+
+// NewTernaryTree returns a new initialized empty TernaryTree.
+func NewTernaryTree() *TernaryTree {
+	return &TernaryTree{}
+}
+
+// Size returns the number of keys in the tree.
+func (t *TernaryTree) Size() int {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return t.size
+}
+
+// Nodes returns the number of nodes of the tree. Deleting keys removes
+// the nodes no other key needs, so it shrinks back as keys go.
+func (t *TernaryTree) Nodes() int {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return countTSTNodes(t.root)
+}
+
+func countTSTNodes(n *tstNode) int {
+	if n == nil {
+		return 0
+	}
+	return 1 + countTSTNodes(n.lo) + countTSTNodes(n.eq) + countTSTNodes(n.hi)
+}
+
+// find returns the node holding the last symbol of key, or nil if the key
+// isn't a path in the tree. The caller must hold the lock.
+func (t *TernaryTree) find(key string) *tstNode {
+	n := t.root
+	i := 0
+	for n != nil {
+		switch c := key[i]; {
+		case c < n.symbol:
+			n = n.lo
+		case c > n.symbol:
+			n = n.hi
+		default:
+			if i++; i == len(key) {
+				return n
+			}
+			n = n.eq
+		}
+	}
+	return nil
+}
+
+// Insert inserts a key value pair into the tree. If the key already
+// exists, the value is updated.
+func (t *TernaryTree) Insert(key string, value interface{}) {
+	if len(key) == 0 {
+		return
+	}
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	t.store(t.insertPath(key), value)
+}
+
+// insertPath returns the node for key, creating the missing nodes on the
+// way. The caller must hold the write lock.
+func (t *TernaryTree) insertPath(key string) *tstNode {
+	link := &t.root
+	i := 0
+	for {
+		if *link == nil {
+			*link = &tstNode{symbol: key[i]}
+		}
+		n := *link
+		switch c := key[i]; {
+		case c < n.symbol:
+			link = &n.lo
+		case c > n.symbol:
+			link = &n.hi
+		default:
+			if i++; i == len(key) {
+				return n
+			}
+			link = &n.eq
+		}
+	}
+}
+
+// store sets the value of n. The caller must hold the write lock.
+func (t *TernaryTree) store(n *tstNode, value interface{}) {
+	switch {
+	case n.value == nil && value != nil:
+		t.size++
+	case n.value != nil && value == nil:
+		t.size--
+	}
+	n.value = value
+}
+
+// Upsert atomically inserts or updates the value of a key, see
+// Trie.Upsert.
+func (t *TernaryTree) Upsert(key string, fn func(old interface{}, exists bool) (interface{}, bool)) (interface{}, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	var old interface{}
+	n := t.find(key)
+	if n != nil {
+		old = n.value
+	}
+
+	value, ok := fn(old, old != nil)
+	switch {
+	case !ok:
+		return old, false
+	case value == nil:
+		if old != nil {
+			t.remove(&t.root, key)
+		}
+	case n == nil:
+		t.store(t.insertPath(key), value)
+	default:
+		t.store(n, value)
+	}
+	return value, true
+}
+
+// LoadOrStore returns the existing value of the key if present. Otherwise,
+// it stores and returns the given value. The loaded result is true if the
+// value was loaded, false if stored.
+func (t *TernaryTree) LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool) {
+	actual, _ = t.Upsert(key, func(old interface{}, exists bool) (interface{}, bool) {
+		loaded = exists
+		return value, !exists
+	})
+	return actual, loaded
+}
+
+// LoadOrStoreMany does LoadOrStore for every key and the value at the
+// same position, in order, under a single lock.
+func (t *TernaryTree) LoadOrStoreMany(keys []string, values []interface{}) (actual []interface{}, loaded []bool) {
+	actual = make([]interface{}, len(keys))
+	loaded = make([]bool, len(keys))
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	for i, key := range keys {
+		if len(key) == 0 {
+			continue
+		}
+		n := t.insertPath(key)
+		if n.value != nil {
+			actual[i], loaded[i] = n.value, true
+			continue
+		}
+		t.store(n, values[i])
+		actual[i] = values[i]
+	}
+	return actual, loaded
+}
+
+// Accepts reports whether key can be stored in the tree, which takes any
+// non-empty key.
+func (t *TernaryTree) Accepts(key string) bool {
+	return len(key) > 0
+}
+
+// Search attempts to search for a value in the tree given a key.
+func (t *TernaryTree) Search(key string) (*interface{}, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	n := t.find(key)
+	if n == nil || n.value == nil {
+		return nil, false
+	}
+	return &n.value, true
+}
+
+// Delete removes a key from the tree and returns the value it held.
+func (t *TernaryTree) Delete(key string) (*interface{}, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	t.rw.Lock()
+	defer t.rw.Unlock()
+
+	value, found := t.remove(&t.root, key)
+	if !found {
+		return nil, false
+	}
+	return &value, true
+}
+
+// remove clears the value of key in the subtree *link points to, and
+// prunes the nodes left without a value and an eq child on the way back
+// up, as Trie.remove does: a node without children is unlinked, one with
+// a single lo or hi child is replaced by it. It returns the value key
+// held, if any. The caller must hold the write lock.
+func (t *TernaryTree) remove(link **tstNode, key string) (interface{}, bool) {
+	n := *link
+	if n == nil {
+		return nil, false
+	}
+	var value interface{}
+	switch c := key[0]; {
+	case c < n.symbol:
+		value, _ = t.remove(&n.lo, key)
+	case c > n.symbol:
+		value, _ = t.remove(&n.hi, key)
+	case len(key) > 1:
+		value, _ = t.remove(&n.eq, key[1:])
+	default:
+		value = n.value
+		t.store(n, nil)
+	}
+	if n.value == nil && n.eq == nil {
+		switch {
+		case n.lo == nil:
+			*link = n.hi
+		case n.hi == nil:
+			*link = n.lo
+		}
+	}
+	return value, value != nil
+}
+
+// GetAllKeys returns all the keys that exist in the tree in lexicographic
+// order.
+func (t *TernaryTree) GetAllKeys() []string {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	var keys []string
+	it := newTSTIterator(t.root, "")
+	for it.next() {
+		keys = append(keys, string(it.key))
+	}
+	return keys
+}
+
+// GetPrefixKeys returns all the keys that exist in the tree with the given
+// prefix, including the prefix itself, in lexicographic order.
+func (t *TernaryTree) GetPrefixKeys(prefix string) []string {
+	if len(prefix) == 0 {
+		return []string{}
+	}
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	var keys []string
+	n := t.find(prefix)
+	if n == nil {
+		return keys
+	}
+	if n.value != nil {
+		keys = append(keys, prefix)
+	}
+	it := newTSTIterator(n.eq, prefix)
+	for it.next() {
+		keys = append(keys, string(it.key))
+	}
+	return keys
+}
+
+// Walk calls fn for every key starting with prefix and its value, in
+// lexicographic order, until fn returns false. An empty prefix walks all
+// keys. The tree is read locked during the walk, so fn must not modify it.
+func (t *TernaryTree) Walk(prefix string, fn func(key string, value interface{}) bool) {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+
+	start := t.root
+	if len(prefix) > 0 {
+		n := t.find(prefix)
+		if n == nil {
+			return
+		}
+		if n.value != nil && !fn(prefix, n.value) {
+			return
+		}
+		start = n.eq
+	}
+	it := newTSTIterator(start, prefix)
+	for it.next() {
+		if !fn(string(it.key), it.curr.value) {
+			return
+		}
+	}
+}
+
+// tstFrame is a single level of the tstIterator's explicit stack. depth is
+// the key length before the node's symbol, state tracks whether the lo
+// branch, the node itself or the hi branch is next.
+type tstFrame struct {
+	node  *tstNode
+	depth int
+	state int
+}
+
+// tstIterator walks a ternary tree in order without recursion, keeping
+// the key of the current node in a single reused buffer.
+type tstIterator struct {
+	stack []tstFrame
+	key   []byte
+	curr  *tstNode
+}
+
+func newTSTIterator(start *tstNode, prefix string) *tstIterator {
+	it := &tstIterator{key: []byte(prefix)}
+	if start != nil {
+		it.stack = append(it.stack, tstFrame{node: start, depth: len(prefix)})
+	}
+	return it
+}
+
+// next advances to the next node holding a value and reports whether
+// there was one.
+func (it *tstIterator) next() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		n, depth := top.node, top.depth
+		switch top.state {
+		case 0:
+			top.state = 1
+			if n.lo != nil {
+				it.stack = append(it.stack, tstFrame{node: n.lo, depth: depth})
+			}
+		case 1:
+			top.state = 2
+			it.key = append(it.key[:depth], n.symbol)
+			if n.eq != nil {
+				it.stack = append(it.stack, tstFrame{node: n.eq, depth: depth + 1})
+			}
+			if n.value != nil {
+				it.curr = n
+				return true
+			}
+		default:
+			it.stack = it.stack[:len(it.stack)-1]
+			if n.hi != nil {
+				it.stack = append(it.stack, tstFrame{node: n.hi, depth: depth})
+			}
+		}
+	}
+	it.curr = nil
+	return false
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/trie"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type intPair = generic.Pair[string, int]
+
+// digitTrie keeps the keys of a table in the digit trie, which rejects
+// any key but a decimal one.
+var digitTrie = generic.WithPrefixIndex(func() trie.PrefixIndex { return trie.NewTrie() })
+
+// intPairs pairs every key with its position counted from 1.
+func intPairs(keys ...string) []intPair {
+	pairs := make([]intPair, len(keys))
+	for i, key := range keys {
+		pairs[i] = intPair{Key: key, Value: i + 1}
+	}
+	return pairs
+}
+
+func statuses(results []generic.SetResult) string {
+	s := ""
+	for _, r := range results {
+		s += r.Status.String()[:1]
+	}
+	return s
+}
+
+func TestHashTableSetMany(t *testing.T) {
+	for name, opts := range map[string][]generic.Option{
+		"chaining":    {generic.WithAutoResize(0.25, 2)},
+		"robin hood":  {generic.WithOpenAddressing()},
+		"fixed size":  nil,
+		"with expiry": {generic.WithAutoResize(0.25, 2)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts = append([]generic.Option{generic.WithHasher(generic.XXHash{})}, opts...)
+			bulk, err := generic.NewHashTable[string, int](4, nil, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			single, _ := generic.NewHashTable[string, int](4, nil, opts...)
+			if name == "with expiry" {
+				bulk.SetWithTTL("999999", 0, time.Hour)
+				single.SetWithTTL("999999", 0, time.Hour)
+			}
+
+			rnd := rand.New(rand.NewSource(1))
+			var pairs []intPair
+			for i := 0; i < 2000; i++ {
+				pairs = append(pairs, intPair{Key: fmt.Sprint(rnd.Intn(1500)), Value: i})
+			}
+			results := bulk.SetMany(pairs)
+			for _, p := range pairs {
+				single.Set(p.Key, p.Value)
+			}
+
+			seen := make(map[string]bool)
+			for i, r := range results {
+				want := generic.Inserted
+				if seen[pairs[i].Key] {
+					want = generic.Updated
+				}
+				seen[pairs[i].Key] = true
+				if r.Status != want || r.Err != nil {
+					t.Fatalf("pair %d %s: %v %v, want %v", i, pairs[i].Key, r.Status, r.Err, want)
+				}
+				if _, v, _ := bulk.GetVersioned(pairs[i].Key); i == len(pairs)-1 && v != r.Version {
+					t.Errorf("last pair has version %d, result says %d", v, r.Version)
+				}
+			}
+			if got, want := fmt.Sprint(bulk.GetAllPairs()), fmt.Sprint(single.GetAllPairs()); got != want {
+				t.Error("SetMany and Set one by one hold different pairs")
+			}
+			if n, want := bulk.Distribution().Entries, len(bulk.GetAllKeys()); n != want {
+				t.Errorf("%d entries in the buckets, want %d", n, want)
+			}
+			for _, p := range bulk.GetAllPairs() {
+				if v, found := bulk.Get(p.Key); !found || v != p.Value {
+					t.Fatalf("Get(%s) = %d, %v, want %d", p.Key, v, found, p.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestHashTableSetManyRejects(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1, digitTrie)
+	hm.Set("2", 0)
+	results := hm.SetMany(intPairs("1", "x", "2", "", "1"))
+	if s := statuses(results); s != "iruru" {
+		t.Errorf("statuses = %s, want iruru", s)
+	}
+	if results[1].Err == nil || results[3].Err == nil {
+		t.Error("rejected pairs have no error")
+	}
+	if v, _ := hm.Get("1"); v != 5 {
+		t.Errorf("1 = %d, want the last value 5", v)
+	}
+
+	results = hm.LoadSorted(intPairs("10", "11", "05", "11", "3"))
+	if s := statuses(results); s != "iirui" {
+		t.Errorf("LoadSorted statuses = %s, want iirui", s)
+	}
+	if got := fmt.Sprint(hm.GetAllKeys()); got != "[1 10 11 2 3]" {
+		t.Errorf("keys = %s", got)
+	}
+}
+
+func TestHashTableSetManyCapacity(t *testing.T) {
+	var evicted []string
+	hm := newCache(t, 3, generic.NewLRU, &evicted)
+	results := hm.SetMany(intPairs("1", "2", "3", "1", "4"))
+	if s := statuses(results); s != "iiiui" {
+		t.Errorf("statuses = %s, want iiiui", s)
+	}
+	if got := fmt.Sprint(hm.GetAllKeys(), evicted); got != "[1 3 4] [2]" {
+		t.Errorf("keys and evicted = %s", got)
+	}
+}
+
+func TestStoreSetMany(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	results, err := s.SetMany(intPairs("1", "", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := statuses(results); st != "iri" {
+		t.Errorf("statuses = %s", st)
+	}
+	if _, err := s.LoadSorted(intPairs("3", "4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, map[string]int{"1": 1, "2": 3, "3": 1, "4": 2})
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/storage"
+	"testing"
+)
+
+func newCache(t *testing.T, capacity int, newPolicy func() generic.EvictionPolicy, evicted *[]string) *generic.HashTable[string, int] {
+	t.Helper()
+	hm, err := generic.NewHashTable[string, int](16, nil,
+		generic.WithHasher(generic.XXHash{}),
+		generic.WithCapacity(capacity, newPolicy),
+		generic.WithEvictionCallback(func(key string, _ int) {
+			*evicted = append(*evicted, key)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hm
+}
+
+func TestHashTableCachePolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		newPolicy func() generic.EvictionPolicy
+		// ops are run in order: "+k" sets k, "k" gets it.
+		ops     []string
+		keys    string
+		evicted string
+	}{
+		{"LRU", generic.NewLRU, []string{"+1", "+2", "+3", "1", "+4", "+5"}, "[1 4 5]", "[2 3]"},
+		{"LFU", generic.NewLFU, []string{"+1", "+2", "+3", "1", "1", "3", "+4", "4", "+5"}, "[1 4 5]", "[2 3]"},
+		{"CLOCK", generic.NewClock, []string{"+1", "+2", "+3", "1", "+4", "+5"}, "[1 4 5]", "[2 3]"},
+		// Setting a stored key again in a full table evicts nothing.
+		{"update", nil, []string{"+1", "+2", "+3", "+1", "+3"}, "[1 2 3]", "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evicted []string
+			hm := newCache(t, 3, tt.newPolicy, &evicted)
+			for _, op := range tt.ops {
+				if op[0] == '+' {
+					hm.Set(op[1:], 0)
+				} else if _, found := hm.Get(op); !found {
+					t.Fatalf("Get(%s) missed", op)
+				}
+			}
+			if got := fmt.Sprint(hm.GetAllKeys()); got != tt.keys {
+				t.Errorf("keys = %s, want %s", got, tt.keys)
+			}
+			if got := fmt.Sprint(evicted); got != tt.evicted {
+				t.Errorf("evicted = %s, want %s", got, tt.evicted)
+			}
+			if n := hm.Distribution().Entries; n != 3 {
+				t.Errorf("%d entries in the buckets, want 3", n)
+			}
+		})
+	}
+}
+
+func TestHashTableCacheStats(t *testing.T) {
+	var evicted []string
+	hm := newCache(t, 2, generic.NewLRU, &evicted)
+	events, cancel := hm.Watch("")
+	defer cancel()
+
+	hm.Set("1", 1)
+	hm.Set("2", 2)
+	hm.Get("1")
+	hm.Set("3", 3)
+	hm.Get("2")
+	hm.Get("3")
+	hm.GetKeysWithPrefix("1")
+	hm.ExpiresAt("3")
+
+	want := generic.CacheStats{Hits: 3, Misses: 1, Evictions: 1}
+	if got := hm.CacheStats(); got != want {
+		t.Errorf("CacheStats() = %+v, want %+v", got, want)
+	}
+	if r := hm.CacheStats().HitRatio(); r != 0.75 {
+		t.Errorf("HitRatio() = %f", r)
+	}
+	if hm.Capacity() != 2 {
+		t.Errorf("Capacity() = %d", hm.Capacity())
+	}
+	if keys := hm.GetKeysWithPrefix("2"); len(keys) != 0 {
+		t.Errorf("evicted key still in the trie: %v", keys)
+	}
+	got, _ := drain(events)
+	if s := formatEvents(got); s != "set 1 0>1;set 2 0>2;evict 2 2>0;set 3 0>3;" {
+		t.Errorf("events: %s", s)
+	}
+}
+
+func TestHashTableCacheOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []generic.Option
+	}{
+		{"negative capacity", []generic.Option{generic.WithCapacity(-1, nil)}},
+		{"callback without capacity", []generic.Option{generic.WithEvictionCallback(func(string, int) {})}},
+		{"callback of other types", []generic.Option{
+			generic.WithCapacity(1, nil), generic.WithEvictionCallback(func(int, int) {})}},
+	}
+	for _, tt := range tests {
+		opts := append([]generic.Option{generic.WithHasher(generic.XXHash{})}, tt.opts...)
+		if _, err := generic.NewHashTable[string, int](16, nil, opts...); err == nil {
+			t.Errorf("%s: NewHashTable succeeded", tt.name)
+		}
+	}
+}
+
+func TestStoreCapacity(t *testing.T) {
+	dir := t.TempDir()
+	var evicted []string
+	open := func(capacity int) *intStore {
+		s, err := storage.Open[string, int](dir, newCache(t, capacity, generic.NewLRU, &evicted), generic.JSONCodec[string, int]{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	reopen := func(s *intStore, capacity int) *intStore {
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return open(capacity)
+	}
+
+	s := open(3)
+	for i := 1; i <= 3; i++ {
+		s.Set(fmt.Sprint(i), i)
+	}
+	// Reading 1 leaves 2 the least recently used, which the log doesn't
+	// know but the logged eviction does.
+	s.Get("1")
+	s.Set("4", 4)
+	s = reopen(s, 3)
+	checkStore(t, s, map[string]int{"1": 1, "3": 3, "4": 4})
+
+	// 5 evicts 1, and 1 evicts 3 within a single record.
+	if _, err := s.SetMany(intPairs("5", "1")); err != nil {
+		t.Fatal(err)
+	}
+	s = reopen(s, 3)
+	checkStore(t, s, map[string]int{"1": 2, "4": 4, "5": 1})
+	if err := s.Set("6", 6); err != nil {
+		t.Fatal(err)
+	}
+	checkStore(t, s, map[string]int{"1": 2, "5": 1, "6": 6})
+
+	// A smaller capacity evicts once the store is open, and the evictions
+	// are logged.
+	evicted = nil
+	s = reopen(s, 2)
+	if s.Len() != 2 || len(evicted) != 1 {
+		t.Fatalf("Len() = %d after %v evicted", s.Len(), evicted)
+	}
+	want := map[string]int{"1": 2, "5": 1, "6": 6}
+	delete(want, evicted[0])
+	s = reopen(s, 3)
+	defer s.Close()
+	checkStore(t, s, want)
+
+	// Deleting neither counts as a lookup nor uses the key.
+	stats := s.CacheStats()
+	for _, key := range []string{"1", "5", "6", "7"} {
+		if _, err := s.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.CacheStats(); got != stats {
+		t.Errorf("CacheStats() = %+v after deletes, want %+v", got, stats)
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHashTableBulkReadsUnderWrites runs bulk reads while writers keep
+// the write lock contended. A reader taking the read lock twice would
+// block behind a waiting writer, which then waits for the reader.
+func TestHashTableBulkReadsUnderWrites(t *testing.T) {
+	const keys, rounds = 500, 2000
+	// Readers and writers need to interleave even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	hm, _ := generic.NewHashTable[string, int](64, nil,
+		generic.WithHasher(generic.FNV1a{}), generic.WithAutoResize(0.25, 2))
+	for i := 0; i < keys; i++ {
+		hm.Set(fmt.Sprintf("98%04d", i), i)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				key := fmt.Sprintf("97%02d%04d", w, r)
+				hm.Set(key, r)
+				hm.Delete(key)
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				pairs := hm.GetPairsWithPrefix("98")
+				if len(pairs) != keys {
+					errs <- fmt.Sprintf("GetPairsWithPrefix returned %d pairs, want %d", len(pairs), keys)
+					return
+				}
+				all := hm.GetAllPairs()
+				if !sort.SliceIsSorted(all, func(i, j int) bool { return all[i].Key < all[j].Key }) {
+					errs <- "GetAllPairs is not ordered by key"
+					return
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("bulk reads hang while writers are waiting")
+	}
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
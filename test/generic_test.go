@@ -0,0 +1,114 @@
+package test
+
+import (
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/trie"
+	"hash/fnv"
+	"testing"
+)
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func TestGenericHashTable(t *testing.T) {
+	hm, err := generic.NewHashTable[models.StudentID, *models.Student](16, nil,
+		generic.WithValueHash((*models.Student).ToHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := models.NewStudent("Test test", "980122680000", 16.5, "TE")
+	hm.Set(st.StudentID, st)
+	got, found := hm.Get("980122680000")
+	if !found || got != st {
+		t.Fatalf("Get = %v, %v", got, found)
+	}
+	pairs := hm.GetPairsWithPrefix("9801")
+	if len(pairs) != 1 || pairs[0].Key != st.StudentID || pairs[0].Value != st {
+		t.Errorf("GetPairsWithPrefix = %v", pairs)
+	}
+	if !hm.Delete(st.StudentID) {
+		t.Error("Student wasn't deleted.")
+	}
+	if _, found := hm.Get(st.StudentID); found {
+		t.Error("Student didn't delete.")
+	}
+}
+
+// TestGenericHashTableDefaultIndex stores keys the digit trie wouldn't
+// take in a table with the default prefix index.
+func TestGenericHashTableDefaultIndex(t *testing.T) {
+	ints, err := generic.NewHashTable[int, string](16, func(k int) uint64 { return uint64(k) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ints.Set(-42, "negative")
+	ints.Set(7, "positive")
+	if v, found := ints.Get(-42); !found || v != "negative" {
+		t.Errorf("Get(-42) = %q, %v", v, found)
+	}
+	if keys := ints.GetKeysWithPrefix("-"); len(keys) != 1 || keys[0] != "-42" {
+		t.Errorf("GetKeysWithPrefix(-) = %v", keys)
+	}
+	if !ints.Delete(-42) || ints.Len() != 1 {
+		t.Errorf("Delete(-42) left %d keys", ints.Len())
+	}
+
+	words, err := generic.NewHashTable[string, int](16, hashString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range []string{"apple", "apricot", "banana"} {
+		words.Set(w, i)
+	}
+	if v, found := words.Get("apricot"); !found || v != 1 {
+		t.Errorf("Get(apricot) = %d, %v", v, found)
+	}
+	if _, found := words.Get("cherry"); found {
+		t.Error("Get(cherry) found a missing key")
+	}
+	if keys := words.GetKeysWithPrefix("ap"); len(keys) != 2 {
+		t.Errorf("GetKeysWithPrefix(ap) = %v", keys)
+	}
+	if err := words.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenericHashTableKeyString(t *testing.T) {
+	type point struct{ x, y int }
+	hm, err := generic.NewHashTable[point, string](16,
+		func(p point) uint64 { return uint64(p.x*31 + p.y) },
+		generic.WithPrefixIndex(func() trie.PrefixIndex { return trie.NewTernaryTree() }),
+		generic.WithKeyString(func(p point) string { return string(rune('a'+p.x)) + string(rune('a'+p.y)) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 5; y++ {
+			hm.Set(point{x, y}, string(rune('a'+x))+string(rune('a'+y)))
+		}
+	}
+	if v, found := hm.Get(point{3, 4}); !found || v != "de" {
+		t.Errorf("Get = %q, %v", v, found)
+	}
+	pairs := hm.GetPairsWithPrefix("c")
+	if len(pairs) != 5 || pairs[0].Key != (point{2, 0}) {
+		t.Errorf("GetPairsWithPrefix = %v", pairs)
+	}
+}
+
+func TestGenericHashTableOptionTypes(t *testing.T) {
+	if _, err := generic.NewHashTable[string, int](16, nil); err == nil {
+		t.Error("table without a hash function was created")
+	}
+	_, err := generic.NewHashTable[string, int](16, hashString,
+		generic.WithValueHash(func(string) uint64 { return 0 }))
+	if err == nil {
+		t.Error("value hash of the wrong type was accepted")
+	}
+}
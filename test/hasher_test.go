@@ -0,0 +1,165 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable"
+	"hash/fnv"
+	"testing"
+)
+
+func TestHasherVectors(t *testing.T) {
+	sipKey := hashtable.SipHash{K0: 0x0706050403020100, K1: 0x0f0e0d0c0b0a0908}
+	sipMsg := make([]byte, 15)
+	for i := range sipMsg {
+		sipMsg[i] = byte(i)
+	}
+	fnvA := fnv.New64a()
+	_, _ = fnvA.Write([]byte("980122680000"))
+
+	tests := []struct {
+		name   string
+		hasher hashtable.Hasher
+		key    string
+		want   uint64
+	}{
+		{"fnv1a", hashtable.FNV1a{}, "980122680000", fnvA.Sum64()},
+		{"jenkins", hashtable.Jenkins{}, "a", 0xca2e9442},
+		{"jenkins", hashtable.Jenkins{}, "The quick brown fox jumps over the lazy dog", 0x519e91f5},
+		{"siphash", sipKey, string(sipMsg), 0xa129ca6149be45e5},
+		{"xxhash", hashtable.XXHash{}, "", 0xef46db3751d8e999},
+		{"xxhash", hashtable.XXHash{}, "abc", 0x44bc2cf5ad770999},
+		{"xxhash", hashtable.XXHash{}, "Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.Hash(tt.key, 0); got != tt.want {
+			t.Errorf("%s(%q) = %#x, want %#x", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHashTableWithHasher(t *testing.T) {
+	hashers := []hashtable.Hasher{
+		hashtable.FNV1a{}, hashtable.Jenkins{}, hashtable.SipHash{}, hashtable.XXHash{}, hashtable.NewMapHash(), &hashtable.MapHash{},
+	}
+	for _, hasher := range hashers {
+		if hasher.Hash("980122680000", 1) == hasher.Hash("980122680000", 2) {
+			t.Errorf("%T ignores the seed", hasher)
+		}
+
+		hm, _ := hashtable.NewHashTable(200, hashtable.WithHasher(hasher))
+		st := models.NewStudent("Test test", "980122680000", 16.5, "TE")
+		if index, _ := hm.Set(st); index != hasher.Hash("980122680000", 0)%200 {
+			t.Errorf("%T: student placed in bucket %d", hasher, index)
+		}
+		if _, found := hm.Get("980122680000"); !found {
+			t.Errorf("%T: student not found", hasher)
+		}
+	}
+}
+
+func TestStudentToHash(t *testing.T) {
+	a := models.NewStudent("Test test", "980122680000", 16.5, "TE")
+	b := models.NewStudent("Other name", "980122680000", 12, "CE")
+	if a.ToHash() != a.ToHash() || a.ToHash() != b.ToHash() {
+		t.Error("ToHash isn't deterministic by student ID")
+	}
+	if c := models.NewStudent("Test test", "980122680001", 16.5, "TE"); c.ToHash() == a.ToHash() {
+		t.Error("ToHash ignores the student ID")
+	}
+}
+
+func TestMapHashZeroValue(t *testing.T) {
+	var m hashtable.MapHash
+	first := m.Hash("980122680000", 1)
+	if m.Hash("980122680000", 1) != first {
+		t.Error("the zero MapHash changed its seed")
+	}
+	if m.Hash("980122680001", 1) == first {
+		t.Error("the zero MapHash ignores the key")
+	}
+}
+
+func BenchmarkHashers(b *testing.B) {
+	hashers := map[string]hashtable.Hasher{
+		"FNV1a":   hashtable.FNV1a{},
+		"Jenkins": hashtable.Jenkins{},
+		"SipHash": hashtable.SipHash{},
+		"XXHash":  hashtable.XXHash{},
+		"MapHash": hashtable.NewMapHash(),
+	}
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprint(980122680000 + i)
+	}
+	for name, hasher := range hashers {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hasher.Hash(keys[i%len(keys)], 0)
+			}
+		})
+	}
+}
+
+// constHasher puts every key in the same bucket.
+type constHasher struct{}
+
+func (constHasher) Hash(string, uint64) uint64 { return 3 }
+
+func TestHashTableDistribution(t *testing.T) {
+	const n, size = 2000, 500
+	for _, tt := range []struct {
+		name string
+		opts []hashtable.Option
+	}{
+		{"chaining", nil},
+		{"open addressing", []hashtable.Option{hashtable.WithOpenAddressing()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := n
+			if tt.opts != nil {
+				entries = size * 8 / 10
+			}
+			hm, _ := hashtable.NewHashTable(size, append(tt.opts, hashtable.WithHasher(hashtable.XXHash{}))...)
+			for i := 0; i < entries; i++ {
+				hm.Set(&testHashAble{val: uint64(9801000000 + i)})
+			}
+			d := hm.Distribution()
+			buckets, total := 0, 0
+			for length, count := range d.Histogram {
+				buckets += count
+				total += length * count
+			}
+			if buckets != size || d.Buckets != size {
+				t.Errorf("histogram covers %d buckets, Buckets is %d, want %d", buckets, d.Buckets, size)
+			}
+			if total != entries || d.Entries != entries {
+				t.Errorf("histogram covers %d entries, Entries is %d, want %d", total, d.Entries, entries)
+			}
+			if d.Max != len(d.Histogram)-1 || d.Histogram[d.Max] == 0 {
+				t.Errorf("Max %d doesn't match histogram %v", d.Max, d.Histogram)
+			}
+			if want := float64(entries) / size; d.Mean != want || d.LoadFactor != want {
+				t.Errorf("Mean %v, LoadFactor %v, want %v", d.Mean, d.LoadFactor, want)
+			}
+			if want := float64(d.Histogram[0]) / size; d.EmptyRatio != want {
+				t.Errorf("EmptyRatio %v, want %v", d.EmptyRatio, want)
+			}
+			if d.ChiSquare > 2*size {
+				t.Errorf("xxhash scores chi-square %v over %d buckets", d.ChiSquare, size)
+			}
+		})
+	}
+
+	hm, _ := hashtable.NewHashTable(size, hashtable.WithHasher(constHasher{}))
+	for i := 0; i < 100; i++ {
+		hm.Set(&testHashAble{val: uint64(i)})
+	}
+	d := hm.Distribution()
+	if d.Max != 100 || d.Histogram[0] != size-1 || d.Histogram[100] != 1 {
+		t.Errorf("constant hash: Max %d, %d empty buckets", d.Max, d.Histogram[0])
+	}
+	if d.ChiSquare < 100*size/2 {
+		t.Errorf("constant hash scores chi-square %v", d.ChiSquare)
+	}
+}
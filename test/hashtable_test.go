@@ -1,14 +1,17 @@
 package test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/matinhimself/trie/models"
 	"github.com/matinhimself/trie/pkg/hashtable"
+	"github.com/matinhimself/trie/pkg/trie"
 	"hash/maphash"
 	"math"
 	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +27,82 @@ func TestHashTableDelete(t *testing.T) {
 }
 
 
+func TestHashTableUpdate(t *testing.T) {
+	stId := "980122680000"
+	hm, _ := hashtable.NewHashTable(200)
+	first, _ := hm.Set(models.NewStudent("Test test", models.StudentID(stId), 16.5, "TE"))
+	second, _ := hm.Set(models.NewStudent("Test updated", models.StudentID(stId), 17, "TE"))
+	if first != second {
+		t.Errorf("update moved the student from bucket %d to %d", first, second)
+	}
+	res, found := hm.Get(stId)
+	if !found || res.Value.(*models.Student).FullName != "Test updated" {
+		t.Error("Student wasn't updated.")
+	}
+	if keys := hm.GetAllKeys(); len(keys) != 1 {
+		t.Errorf("update added a key, got %v", keys)
+	}
+}
+
+func TestHashTableAutoResize(t *testing.T) {
+	hm, _ := hashtable.NewHashTable(8, hashtable.WithAutoResize(0.25, 2))
+	ids := make([]string, 5000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("9801%08d", i)
+		hm.Set(models.NewStudent("Test test", models.StudentID(ids[i]), 16.5, "TE"))
+		// Every key has to stay reachable while buckets are migrated.
+		if i%97 == 0 {
+			for _, id := range ids[:i+1] {
+				if _, found := hm.Get(id); !found {
+					t.Fatalf("student %s lost after %d inserts", id, i+1)
+				}
+			}
+		}
+	}
+	if hm.Size() < 5000/2/2 {
+		t.Errorf("table didn't grow, size is %d", hm.Size())
+	}
+
+	for _, id := range ids[10:] {
+		if !hm.Delete(id) {
+			t.Fatalf("student %s wasn't deleted", id)
+		}
+	}
+	for _, id := range ids[:10] {
+		if _, found := hm.Get(id); !found {
+			t.Fatalf("student %s lost while shrinking", id)
+		}
+	}
+	if hm.Size() > 64 {
+		t.Errorf("table didn't shrink, size is %d", hm.Size())
+	}
+}
+
+func TestHashTableOpenAddressing(t *testing.T) {
+	hm, _ := hashtable.NewHashTable(8, hashtable.WithOpenAddressing(), hashtable.WithAutoResize(0.2, 0.9))
+	live := make(map[string]bool)
+	for i := 0; i < 20000; i++ {
+		id := fmt.Sprintf("9801%08d", rand.Intn(5000))
+		if rand.Intn(3) == 0 {
+			if hm.Delete(id) != live[id] {
+				t.Fatalf("Delete(%s) disagrees with a previous Set", id)
+			}
+			delete(live, id)
+			continue
+		}
+		hm.Set(models.NewStudent("Test test", models.StudentID(id), 16.5, "TE"))
+		live[id] = true
+	}
+	for id := range live {
+		if res, found := hm.Get(id); !found || res.Value.GetKey() != id {
+			t.Fatalf("student %s not found", id)
+		}
+	}
+	if keys := hm.GetAllKeys(); len(keys) != len(live) {
+		t.Errorf("trie holds %d keys, want %d", len(keys), len(live))
+	}
+}
+
 func loadMassiveData(studentCount int, middleCount int, hm *hashtable.HashTable, ls []int) {
 	for i := 0; i < middleCount; i++ {
 		middle := fmt.Sprintf("%04d", rand.Intn(9999))
@@ -36,7 +115,8 @@ func loadMassiveData(studentCount int, middleCount int, hm *hashtable.HashTable,
 				gpa,
 				"CE",
 			)
-			ls[hm.Set(student)] += 1
+			index, _ := hm.Set(student)
+			ls[index] += 1
 		}
 	}
 }
@@ -112,3 +192,83 @@ func MinMax(array []int) (int, int) {
 	}
 	return min, max
 }
+
+func TestHashTableWriteDOT(t *testing.T) {
+	hm, _ := hashtable.NewHashTable(1)
+	for i := 0; i < 5; i++ {
+		hm.Set(models.NewStudent("Test test", models.StudentID(fmt.Sprintf("98012268%04d", i)), 16.5, "TE"))
+	}
+	hm.Set(models.NewStudent("Test test", "970122680000", 16.5, "TE"))
+
+	var buf bytes.Buffer
+	if err := hm.WriteDOT(&buf, hashtable.DOTOptions{Prefix: "98", MaxDepth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Count(out, "shape=ellipse") != 3 || !strings.Contains(out, "+2 more") {
+		t.Errorf("chain wasn't cut after 3 entries:\n%s", out)
+	}
+	if strings.Contains(out, "970122680000") {
+		t.Errorf("key outside of the prefix was rendered:\n%s", out)
+	}
+}
+
+func newTernaryHashTable(size int) (*hashtable.HashTable, error) {
+	return hashtable.NewHashTable(size, hashtable.WithPrefixIndex(func() trie.PrefixIndex {
+		return trie.NewTernaryTree()
+	}))
+}
+
+func TestHashTableTernaryIndex(t *testing.T) {
+	hm, _ := newTernaryHashTable(200)
+	loadMassiveData(75, 50, hm, make([]int, 200))
+	keys := hm.GetAllKeys()
+	if len(keys) == 0 || !sort.StringsAreSorted(keys) {
+		t.Fatalf("GetAllKeys returned %d keys, sorted: %v", len(keys), sort.StringsAreSorted(keys))
+	}
+	for _, key := range keys {
+		if _, found := hm.Get(key); !found {
+			t.Fatalf("key %s not found", key)
+		}
+	}
+	if !hm.Delete(keys[0]) {
+		t.Fatalf("key %s wasn't deleted", keys[0])
+	}
+	if _, found := hm.Get(keys[0]); found {
+		t.Error("deleted key found in hashtable")
+	}
+}
+
+func benchmarkIndexSetGet(b *testing.B, hm *hashtable.HashTable) {
+	students := make([]*models.Student, 20000)
+	for i := range students {
+		students[i] = models.NewStudent("bench", models.StudentID(fmt.Sprintf("9801%08d", i*7)), 15, "CE")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := students[i%len(students)]
+		hm.Set(st)
+		hm.Get(string(st.StudentID))
+	}
+}
+
+func BenchmarkHashTableTrieIndex(b *testing.B) {
+	hm, _ := hashtable.NewHashTable(1000)
+	benchmarkIndexSetGet(b, hm)
+}
+
+func BenchmarkHashTableTernaryIndex(b *testing.B) {
+	hm, _ := newTernaryHashTable(1000)
+	benchmarkIndexSetGet(b, hm)
+}
+
+func BenchmarkHashTableChaining(b *testing.B) {
+	hm, _ := hashtable.NewHashTable(1000, hashtable.WithAutoResize(0.25, 2))
+	benchmarkIndexSetGet(b, hm)
+}
+
+func BenchmarkHashTableRobinHood(b *testing.B) {
+	hm, _ := hashtable.NewHashTable(1000, hashtable.WithOpenAddressing(), hashtable.WithAutoResize(0.2, 0.9))
+	benchmarkIndexSetGet(b, hm)
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func newIndexedStudents(t *testing.T) *generic.HashTable[models.StudentID, *models.Student] {
+	t.Helper()
+	hm, err := generic.NewHashTable[models.StudentID, *models.Student](16, nil,
+		generic.WithHasher(generic.FNV1a{}),
+		generic.WithIndex("discipline", func(s *models.Student) []string { return []string{s.Discipline} }),
+		generic.WithIndex("name", func(s *models.Student) []string { return generic.Tokens(s.FullName) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hm
+}
+
+func pairKeys[K comparable, V any](pairs []generic.Pair[K, V]) string {
+	keys := make([]K, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.Key
+	}
+	return fmt.Sprint(keys)
+}
+
+func TestHashTableSecondaryIndex(t *testing.T) {
+	hm := newIndexedStudents(t)
+	for _, s := range []*models.Student{
+		models.NewStudent("Ali Rezaei", "3", 17, "CE"),
+		models.NewStudent("Sara Ahmadi", "1", 18, "EE"),
+		models.NewStudent("Reza Alavi", "2", 15, "CE"),
+		models.NewStudent("Mina Alizadeh", "4", 16, "ME"),
+	} {
+		hm.Set(s.StudentID, s)
+	}
+
+	check := func(name, term string, prefix bool, want string) {
+		t.Helper()
+		get := hm.GetByIndex
+		if prefix {
+			get = hm.GetByIndexPrefix
+		}
+		pairs, err := get(name, term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pairKeys(pairs); got != want {
+			t.Errorf("%s %q (prefix %v) = %s, want %s", name, term, prefix, got, want)
+		}
+	}
+	check("discipline", "CE", false, "[2 3]")
+	check("discipline", "C", false, "[]")
+	check("discipline", "", true, "[]")
+	check("name", "reza", false, "[2]")
+	check("name", "ali", true, "[3 4]")
+	check("name", "al", true, "[2 3 4]")
+
+	// Update through Set, with the value changed in place.
+	s, _ := hm.Get("3")
+	s.UpdateStudent("Ali Karimi", "3", 17, "EE")
+	hm.Set("3", s)
+	check("discipline", "CE", false, "[2]")
+	check("discipline", "EE", false, "[1 3]")
+	check("name", "rezaei", false, "[]")
+	check("name", "kar", true, "[3]")
+
+	hm.Delete("1")
+	check("discipline", "EE", false, "[3]")
+	check("name", "sara", false, "[]")
+
+	if _, err := hm.GetByIndex("gpa", "17"); err == nil {
+		t.Error("no error for an unknown index")
+	}
+	_, err := generic.NewHashTable[string, int](16, nil, generic.WithHasher(generic.FNV1a{}),
+		generic.WithIndex("name", func(s *models.Student) []string { return nil }))
+	if err == nil {
+		t.Error("no error for an extractor of another value type")
+	}
+}
+
+func TestHashTableOrderedIndex(t *testing.T) {
+	hm, err := generic.NewHashTable[string, float64](32, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2),
+		generic.WithOrderedIndex("score", func(v float64) float64 { return v }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	want := make(map[string]float64)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprint(rnd.Intn(1000))
+		switch rnd.Intn(4) {
+		case 0:
+			hm.Delete(key)
+			delete(want, key)
+		default:
+			// Few distinct scores, so there are plenty of ties.
+			score := float64(rnd.Intn(40)) / 2
+			hm.Set(key, score)
+			want[key] = score
+		}
+	}
+	hm.Set("1000", math.NaN())
+
+	sorted := make([]string, 0, len(want))
+	for k := range want {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		return want[a] < want[b] || want[a] == want[b] && a < b
+	})
+
+	for i, k := range sorted {
+		rank, found, err := hm.Rank("score", k)
+		if err != nil || !found || rank != i {
+			t.Fatalf("Rank(%s) = %d, %v, %v, want %d", k, rank, found, err, i)
+		}
+	}
+	if _, found, _ := hm.Rank("score", "1000"); found {
+		t.Error("NaN score is ranked")
+	}
+
+	pairs, _ := hm.Range("score", 5, 7.5)
+	var inRange []string
+	for _, k := range sorted {
+		if want[k] >= 5 && want[k] <= 7.5 {
+			inRange = append(inRange, k)
+		}
+	}
+	if got := pairKeys(pairs); got != fmt.Sprint(inRange) {
+		t.Errorf("Range(5, 7.5) = %s, want %v", got, inRange)
+	}
+
+	top, _ := hm.TopK("score", 10)
+	for i, p := range top {
+		if k := sorted[len(sorted)-1-i]; p.Key != k || p.Value != want[k] {
+			t.Errorf("TopK[%d] = %v, want %s: %v", i, p, k, want[k])
+		}
+	}
+	if all, _ := hm.TopK("score", len(sorted)+5); len(all) != len(sorted) {
+		t.Errorf("TopK beyond the size returned %d pairs, want %d", len(all), len(sorted))
+	}
+
+	for _, p := range []float64{0, 1, 25, 50, 90, 100} {
+		got, found, err := hm.Percentile("score", p)
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		if err != nil || !found || got.Key != sorted[rank-1] {
+			t.Errorf("Percentile(%v) = %v, %v, %v, want %s", p, got, found, err, sorted[rank-1])
+		}
+	}
+	if _, _, err := hm.Percentile("score", 101); err == nil {
+		t.Error("no error for percentile 101")
+	}
+	if _, err := hm.TopK("gpa", 1); err == nil {
+		t.Error("no error for an unknown index")
+	}
+}
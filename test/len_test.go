@@ -0,0 +1,160 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/trie"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestHashTableLen runs random changes of every kind against a map and
+// checks the accounting and the invariants after each of them.
+func TestHashTableLen(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []generic.Option
+	}{
+		{"chaining", []generic.Option{generic.WithAutoResize(0.25, 2)}},
+		{"robin hood", []generic.Option{generic.WithOpenAddressing(), generic.WithAutoResize(0.2, 0.8)}},
+		{"ternary tree", []generic.Option{
+			generic.WithAutoResize(0.25, 2),
+			generic.WithPrefixIndex(func() trie.PrefixIndex { return trie.NewTernaryTree() })}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			hm := newExpiringTable(t, clock, tt.opts...)
+			want := make(map[string]int)
+			// expires holds when the keys set with a TTL expire.
+			expires := make(map[string]time.Time)
+			rnd := rand.New(rand.NewSource(1))
+			key := func() string { return fmt.Sprint(rnd.Intn(300)) }
+
+			for i := 0; i < 5000; i++ {
+				k := key()
+				switch op := rnd.Intn(10); {
+				case op < 4:
+					hm.Set(k, i)
+					want[k] = i
+					delete(expires, k)
+				case op < 6:
+					hm.Delete(k)
+					delete(want, k)
+					delete(expires, k)
+				case op == 6:
+					hm.SetWithTTL(k, i, time.Duration(1+rnd.Intn(5))*time.Second)
+					want[k] = i
+					expires[k], _ = hm.ExpiresAt(k)
+				case op == 7:
+					to := key()
+					if _, err := hm.Rekey(k, to, i); err == nil {
+						delete(want, k)
+						delete(expires, k)
+						want[to] = i
+						delete(expires, to)
+					}
+				case op == 8:
+					pairs := []intPair{{Key: k, Value: i}, {Key: key(), Value: i}}
+					hm.SetMany(pairs)
+					for _, p := range pairs {
+						want[p.Key] = p.Value
+						delete(expires, p.Key)
+					}
+				default:
+					clock.Advance(time.Second)
+					if rnd.Intn(2) == 0 {
+						hm.ExpireNow()
+					}
+				}
+				for k, at := range expires {
+					if !clock.Now().Before(at) {
+						delete(want, k)
+						delete(expires, k)
+					}
+				}
+
+				if err := hm.CheckInvariants(); err != nil {
+					t.Fatalf("op %d: %v", i, err)
+				}
+				if n := hm.Len(); n != len(want) {
+					t.Fatalf("op %d: Len() = %d, want %d", i, n, len(want))
+				}
+			}
+			if lf, d := hm.LoadFactor(), hm.Distribution(); lf != d.LoadFactor {
+				t.Errorf("LoadFactor() = %f, Distribution says %f", lf, d.LoadFactor)
+			}
+			if n := len(hm.GetAllKeys()); n != len(want) {
+				t.Errorf("%d keys listed, want %d", n, len(want))
+			}
+		})
+	}
+}
+
+func TestHashTableLenCapacity(t *testing.T) {
+	var evicted []string
+	hm := newCache(t, 3, generic.NewLFU, &evicted)
+	for i := 0; i < 10; i++ {
+		hm.Set(fmt.Sprint(i), i)
+		if err := hm.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hm.Len() != 3 || hm.Capacity() != 3 || len(evicted) != 7 {
+		t.Errorf("Len() = %d, Capacity() = %d, %d evicted", hm.Len(), hm.Capacity(), len(evicted))
+	}
+	if lf := hm.LoadFactor(); lf != 3.0/16 {
+		t.Errorf("LoadFactor() = %f", lf)
+	}
+}
+
+func TestShardedHashTableLen(t *testing.T) {
+	st, err := generic.NewShardedHashTable[string, int](4, 64, nil, generic.WithHasher(generic.XXHash{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		st.Set(fmt.Sprint(i), i)
+	}
+	for i := 0; i < 100; i += 4 {
+		st.Delete(fmt.Sprint(i))
+	}
+	if err := st.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	if st.Len() != 75 {
+		t.Errorf("Len() = %d, want 75", st.Len())
+	}
+	if lf := st.LoadFactor(); lf != 75.0/64 {
+		t.Errorf("LoadFactor() = %f, want %f", lf, 75.0/64)
+	}
+}
+
+func TestHashTableLenRejectedKey(t *testing.T) {
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock)
+	hm.Set("1", 1)
+	if _, err := hm.Set("", 2); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("Set of the empty key: %v", err)
+	}
+	if _, err := hm.SetWithTTL("", 2, time.Second); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("SetWithTTL of the empty key: %v", err)
+	}
+	if _, err := hm.CompareAndSet("", 2, 0); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("CompareAndSet of the empty key: %v", err)
+	}
+	if r := hm.SetMany(intPairs("")); !errors.Is(r[0].Err, generic.ErrKeyRejected) {
+		t.Errorf("SetMany of the empty key: %+v", r[0])
+	}
+	if _, found := hm.Get(""); found || hm.Delete("") {
+		t.Error("the empty key was stored")
+	}
+	if err := hm.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	if _, v, _ := hm.GetVersioned("1"); hm.Len() != 1 || v != 1 {
+		t.Errorf("Len() = %d, version of 1 = %d after the rejected sets", hm.Len(), v)
+	}
+}
@@ -0,0 +1,300 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var (
+	queryDisciplines = []string{"CE", "EE", "ME", "CS"}
+	queryNames       = []string{"ali", "sara", "reza", "mina", "alireza", "samira", "amir"}
+)
+
+func newQueryStudents(t *testing.T, n int) (*generic.HashTable[models.StudentID, *models.Student], []*models.Student) {
+	t.Helper()
+	hm, err := generic.NewHashTable[models.StudentID, *models.Student](64, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2),
+		generic.WithIndex("discipline", func(s *models.Student) []string { return []string{s.Discipline} }),
+		generic.WithIndex("name", func(s *models.Student) []string { return generic.Tokens(s.FullName) }),
+		generic.WithOrderedIndex("gpa", func(s *models.Student) float64 { return s.GPA }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(7))
+	students := make([]*models.Student, n)
+	for i := range students {
+		name := queryNames[rnd.Intn(len(queryNames))] + " " + queryNames[rnd.Intn(len(queryNames))]
+		id := models.StudentID(fmt.Sprintf("98%04d", rnd.Intn(10000)))
+		s := models.NewStudent(name, id, float64(rnd.Intn(41))/2, queryDisciplines[rnd.Intn(len(queryDisciplines))])
+		hm.Set(s.StudentID, s)
+		students[i] = s
+	}
+	return hm, students
+}
+
+// queryCase is a query along with the same selection done by hand.
+type queryCase struct {
+	build  func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student]
+	match  func(s *models.Student) bool
+	less   func(a, b *models.Student) bool
+	offset int
+	limit  int
+}
+
+func byID(a, b *models.Student) bool { return a.StudentID < b.StudentID }
+
+func byGPA(a, b *models.Student) bool {
+	return a.GPA < b.GPA || a.GPA == b.GPA && a.StudentID < b.StudentID
+}
+
+func hasName(s *models.Student, match func(token string) bool) bool {
+	for _, token := range generic.Tokens(s.FullName) {
+		if match(token) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHashTableQuery(t *testing.T) {
+	hm, students := newQueryStudents(t, 800)
+	byKey := make(map[models.StudentID]*models.Student)
+	for _, s := range students {
+		byKey[s.StudentID] = s
+	}
+
+	cases := map[string]queryCase{
+		"all": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q
+			},
+			less: byID, limit: -1,
+		},
+		"discipline by gpa": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.Where(generic.Eq("discipline", "CE")).OrderBy("gpa", true).Limit(10)
+			},
+			match: func(s *models.Student) bool { return s.Discipline == "CE" },
+			less:  func(a, b *models.Student) bool { return byGPA(b, a) }, limit: 10,
+		},
+		"gpa range": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.Where(generic.Between("gpa", 12, 14)).OrderBy("gpa", false)
+			},
+			match: func(s *models.Student) bool { return s.GPA >= 12 && s.GPA <= 14 },
+			less:  byGPA, limit: -1,
+		},
+		"gpa range descending paged": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.Where(generic.Between("gpa", 5, 15)).OrderBy("gpa", true).Offset(7).Limit(20)
+			},
+			match: func(s *models.Student) bool { return s.GPA >= 5 && s.GPA <= 15 },
+			less:  func(a, b *models.Student) bool { return byGPA(b, a) }, offset: 7, limit: 20,
+		},
+		"key prefix and name": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.KeyPrefix("981").Where(generic.HasPrefix("name", "ali"))
+			},
+			match: func(s *models.Student) bool {
+				return strings.HasPrefix(string(s.StudentID), "981") &&
+					hasName(s, func(token string) bool { return strings.HasPrefix(token, "ali") })
+			},
+			less: byID, limit: -1,
+		},
+		"key range contains": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.KeyRange("980500", "983000").Where(generic.Contains("name", "mi")).OrderByKey(true).Offset(3)
+			},
+			match: func(s *models.Student) bool {
+				return s.StudentID >= "980500" && s.StudentID <= "983000" &&
+					hasName(s, func(token string) bool { return strings.Contains(token, "mi") })
+			},
+			less: func(a, b *models.Student) bool { return byID(b, a) }, offset: 3, limit: -1,
+		},
+		"top gpa with filter": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.Filter(func(_ models.StudentID, s *models.Student) bool { return s.Discipline != "ME" }).
+					OrderBy("gpa", true).Limit(15)
+			},
+			match: func(s *models.Student) bool { return s.Discipline != "ME" },
+			less:  func(a, b *models.Student) bool { return byGPA(b, a) }, limit: 15,
+		},
+		"order by discipline": {
+			build: func(q *generic.Query[models.StudentID, *models.Student]) *generic.Query[models.StudentID, *models.Student] {
+				return q.Where(generic.Between("gpa", 18, 20)).OrderBy("discipline", false)
+			},
+			match: func(s *models.Student) bool { return s.GPA >= 18 },
+			less: func(a, b *models.Student) bool {
+				return a.Discipline < b.Discipline || a.Discipline == b.Discipline && a.StudentID < b.StudentID
+			},
+			limit: -1,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var want []*models.Student
+			for _, s := range byKey {
+				if tt.match == nil || tt.match(s) {
+					want = append(want, s)
+				}
+			}
+			sort.Slice(want, func(i, j int) bool { return tt.less(want[i], want[j]) })
+			if tt.offset > len(want) {
+				want = nil
+			} else {
+				want = want[tt.offset:]
+			}
+			if tt.limit >= 0 && tt.limit < len(want) {
+				want = want[:tt.limit]
+			}
+
+			q := tt.build(hm.Query())
+			got, err := q.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, _ := q.Explain()
+			if len(got) != len(want) {
+				t.Fatalf("got %d pairs, want %d\nplan:\n%s", len(got), len(want), plan)
+			}
+			for i := range got {
+				if got[i].Value != want[i] {
+					t.Fatalf("pair %d is %s, want %s\nplan:\n%s", i, got[i].Key, want[i].StudentID, plan)
+				}
+			}
+		})
+	}
+}
+
+func TestHashTableQueryPlan(t *testing.T) {
+	hm, _ := newQueryStudents(t, 400)
+	tests := []struct {
+		query *generic.Query[models.StudentID, *models.Student]
+		first string
+	}{
+		{hm.Query(), "walk all keys"},
+		{hm.Query().KeyPrefix("98"), `walk keys with prefix "98"`},
+		{hm.Query().KeyRange("9812", "9819"), `walk keys with prefix "981"`},
+		{hm.Query().OrderBy("gpa", true).Limit(10), "scan ordered index gpa descending"},
+		{hm.Query().Where(generic.Between("gpa", 0, 20), generic.Eq("discipline", "CE")), `look up index discipline = "CE"`},
+		{hm.Query().Where(generic.Eq("discipline", "CE"), generic.Between("gpa", 20, 20)), "look up index gpa in [20, 20]"},
+		{hm.Query().Where(generic.Between("gpa", 19, 20)).OrderBy("gpa", false), "scan ordered index gpa [19, 20] ascending"},
+	}
+	for _, tt := range tests {
+		plan, err := tt.query.Explain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(plan, tt.first) {
+			t.Errorf("plan starts with %q, want %q", strings.SplitN(plan, "\n", 2)[0], tt.first)
+		}
+	}
+
+	for _, q := range []*generic.Query[models.StudentID, *models.Student]{
+		hm.Query().Where(generic.Eq("gpa", "20")),
+		hm.Query().Where(generic.Between("name", 0, 1)),
+		hm.Query().Where(generic.Eq("age", "20")),
+		hm.Query().OrderBy("age", false),
+	} {
+		if _, err := q.Run(); err == nil {
+			plan, _ := q.Explain()
+			t.Errorf("no error for an invalid query, plan:\n%s", plan)
+		}
+	}
+
+	names, err := generic.Project(hm.Query().Where(generic.Between("gpa", 20, 20)),
+		func(_ models.StudentID, s *models.Student) string { return s.FullName })
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _ := hm.Query().Where(generic.Between("gpa", 20, 20)).Run()
+	if len(names) != len(all) {
+		t.Errorf("projected %d names, want %d", len(names), len(all))
+	}
+}
+
+func TestHashTableQueryUnscored(t *testing.T) {
+	hm, err := generic.NewHashTable[models.StudentID, *models.Student](16, nil,
+		generic.WithHasher(generic.XXHash{}),
+		generic.WithIndex("discipline", func(s *models.Student) []string { return []string{s.Discipline} }),
+		// A negative GPA is unknown and left out of the order.
+		generic.WithOrderedIndex("gpa", func(s *models.Student) float64 {
+			if s.GPA < 0 {
+				return math.NaN()
+			}
+			return s.GPA
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*models.Student{
+		models.NewStudent("a", "1", 15, "CE"),
+		models.NewStudent("b", "2", -1, "CE"),
+		models.NewStudent("c", "3", 18, "CE"),
+		models.NewStudent("d", "4", 12, "CE"),
+	} {
+		hm.Set(s.StudentID, s)
+	}
+
+	// Every plan keeps the unscored values, last.
+	queries := map[string]func() *generic.Query[models.StudentID, *models.Student]{
+		"all": hm.Query,
+		"discipline": func() *generic.Query[models.StudentID, *models.Student] {
+			return hm.Query().Where(generic.Eq("discipline", "CE"))
+		},
+		"key prefix": func() *generic.Query[models.StudentID, *models.Student] { return hm.Query().KeyPrefix("") },
+		"key range":  func() *generic.Query[models.StudentID, *models.Student] { return hm.Query().KeyRange("1", "4") },
+		"filter func": func() *generic.Query[models.StudentID, *models.Student] {
+			return hm.Query().Filter(func(models.StudentID, *models.Student) bool { return true })
+		},
+	}
+	for name, query := range queries {
+		for desc, want := range map[bool]string{false: "[4 1 3 2]", true: "[3 1 4 2]"} {
+			pairs, err := query().OrderBy("gpa", desc).Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pairKeys(pairs); got != want {
+				t.Errorf("%s ordered by gpa, descending %v: %s, want %s", name, desc, got, want)
+			}
+		}
+	}
+}
+
+func TestHashTableQueryInvalidKeys(t *testing.T) {
+	hm, err := generic.NewHashTable[string, int](16, nil, generic.WithHasher(generic.XXHash{}), digitTrie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm.Set("12", 1)
+
+	for _, q := range []*generic.Query[string, int]{
+		hm.Query().KeyPrefix("x"),
+		hm.Query().KeyRange("a", "b"),
+		hm.Query().KeyRange("1", "1x"),
+	} {
+		if _, err := q.Run(); !errors.Is(err, generic.ErrKeyRejected) {
+			t.Errorf("Run() error = %v, want %v", err, generic.ErrKeyRejected)
+		}
+	}
+	if _, err := hm.Query().Offset(-1).Run(); err == nil {
+		t.Error("no error for a negative offset")
+	}
+	pairs, err := hm.Query().KeyPrefix("").KeyRange("", "2").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pairKeys(pairs); got != "[12]" {
+		t.Errorf("empty prefix and bound: %s, want [12]", got)
+	}
+}
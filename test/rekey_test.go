@@ -0,0 +1,137 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"testing"
+)
+
+func TestHashTableRekey(t *testing.T) {
+	for name, opt := range map[string]generic.Option{
+		"chaining":   generic.WithAutoResize(0.75, 2),
+		"robin hood": generic.WithOpenAddressing(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			hm, err := generic.NewHashTable[string, int](4, nil, generic.WithHasher(generic.XXHash{}), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 50; i++ {
+				hm.Set(fmt.Sprint(i), i)
+			}
+			all, cancelAll := hm.Watch("")
+			defer cancelAll()
+			fives, cancelFives := hm.Watch("5")
+			defer cancelFives()
+
+			// Move every key to a key 100 higher, each time through a
+			// table that resizes or shifts entries on the way.
+			for i := 0; i < 50; i++ {
+				version, err := hm.Rekey(fmt.Sprint(i), fmt.Sprint(i+100), i+1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, v, _ := hm.GetVersioned(fmt.Sprint(i + 100)); v != version || version != uint64(51+i) {
+					t.Fatalf("moved %d has version %d, Rekey returned %d", i, v, version)
+				}
+			}
+			for i := 0; i < 50; i++ {
+				if _, found := hm.Get(fmt.Sprint(i)); found {
+					t.Fatalf("old key %d still found", i)
+				}
+				if v, found := hm.Get(fmt.Sprint(i + 100)); !found || v != i+1 {
+					t.Fatalf("Get(%d) = %d, %v", i+100, v, found)
+				}
+			}
+			if n, keys := hm.Distribution().Entries, len(hm.GetAllKeys()); n != 50 || keys != 50 {
+				t.Errorf("%d entries in the buckets, %d keys in the trie, want 50", n, keys)
+			}
+
+			events, _ := drain(all)
+			if len(events) != 50 {
+				t.Fatalf("%d events for 50 moves", len(events))
+			}
+			ev := events[5]
+			if ev.Kind != generic.EventRekey || ev.OldKey != "5" || ev.Key != "105" || ev.Old != 5 || ev.New != 6 {
+				t.Errorf("event of the move of 5: %+v", ev)
+			}
+			// Only the move of 5 touches a key starting with 5, its old one.
+			if got, _ := drain(fives); len(got) != 1 || got[0].OldKey != "5" {
+				t.Errorf("watcher of 5 got %+v", got)
+			}
+		})
+	}
+}
+
+func TestHashTableRekeyFails(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1, digitTrie)
+	hm.Set("1", 1)
+	hm.Set("2", 2)
+	events, cancel := hm.Watch("")
+	defer cancel()
+
+	_, err := hm.Rekey("1", "2", 3)
+	var conflict *generic.ConflictError
+	if !errors.As(err, &conflict) || conflict.Key != "2" || conflict.Actual != 2 {
+		t.Errorf("moving onto a taken key: %v", err)
+	}
+	if _, err := hm.Rekey("3", "4", 3); !errors.Is(err, generic.ErrNotFound) {
+		t.Errorf("moving a missing key: %v", err)
+	}
+	if _, err := hm.Rekey("1", "x", 3); err == nil {
+		t.Error("moving to a key the trie doesn't accept succeeded")
+	}
+	if got := fmt.Sprint(hm.GetAllPairs()); got != "[{1 1} {2 2}]" {
+		t.Errorf("pairs after failed moves: %s", got)
+	}
+
+	// A move to the key itself sets the value.
+	if version, err := hm.Rekey("1", "1", 5); err != nil || version != 3 {
+		t.Errorf("Rekey(1, 1) = %d, %v", version, err)
+	}
+	if got, _ := drain(events); formatEvents(got) != "update 1 1>5;" {
+		t.Errorf("events: %s", formatEvents(got))
+	}
+}
+
+func TestHashTableRekeyIndex(t *testing.T) {
+	hm := newIndexedStudents(t)
+	hm.Set("1", models.NewStudent("Sara Ahmadi", "1", 18, "EE"))
+	hm.Set("2", models.NewStudent("Reza Alavi", "2", 15, "CE"))
+
+	if _, err := hm.Rekey("1", "3", models.NewStudent("Sara Ahmadi", "3", 18, "CE")); err != nil {
+		t.Fatal(err)
+	}
+	ce, _ := hm.GetByIndex("discipline", "CE")
+	ee, _ := hm.GetByIndex("discipline", "EE")
+	sara, _ := hm.GetByIndex("name", "sara")
+	if got := fmt.Sprint(pairKeys(ce), pairKeys(ee), pairKeys(sara)); got != "[2 3][][3]" {
+		t.Errorf("index after the move: %s", got)
+	}
+}
+
+func TestStoreRekey(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	s.Set("1", 1)
+	s.Set("2", 2)
+	if _, err := s.Rekey("1", "2", 3); err == nil {
+		t.Error("moving onto a taken key succeeded")
+	}
+	version, err := s.Rekey("1", "3", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, map[string]int{"2": 2, "3": 3})
+	if _, v, _ := s.GetVersioned("3"); v != version {
+		t.Errorf("replayed version %d, want %d", v, version)
+	}
+}
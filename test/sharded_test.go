@@ -0,0 +1,126 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedHashTable(t *testing.T) {
+	const writers, perWriter = 8, 500
+	st, err := generic.NewShardedHashTable[string, int](8, 800, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				n := w*perWriter + i
+				st.Set(fmt.Sprintf("98%06d", n), n)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	keys := st.GetAllKeys()
+	if len(keys) != writers*perWriter {
+		t.Fatalf("got %d keys, want %d", len(keys), writers*perWriter)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Error("keys are not merged in order")
+	}
+	pairs := st.GetAllPairs()
+	for i, p := range pairs {
+		if p.Key != keys[i] || p.Value != i {
+			t.Fatalf("pair %d is %v, want %s: %d", i, p, keys[i], i)
+		}
+	}
+
+	prefix := "98001"
+	want := make([]string, 0)
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			want = append(want, k)
+		}
+	}
+	got := st.GetKeysWithPrefix(prefix)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetKeysWithPrefix(%q) = %v, want %v", prefix, got, want)
+	}
+	if ps := st.GetPairsWithPrefix(prefix); len(ps) != len(want) {
+		t.Errorf("GetPairsWithPrefix(%q) returned %d pairs, want %d", prefix, len(ps), len(want))
+	}
+
+	for _, k := range want {
+		if !st.Delete(k) {
+			t.Errorf("Delete(%s) = false", k)
+		}
+		if _, found := st.Get(k); found {
+			t.Errorf("%s found after delete", k)
+		}
+	}
+	if d := st.Distribution(); d.Entries != len(keys)-len(want) {
+		t.Errorf("Distribution counts %d entries, want %d", d.Entries, len(keys)-len(want))
+	}
+}
+
+func TestShardedHashTableAble(t *testing.T) {
+	st, err := hashtable.NewShardedHashTable(4, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		st.Set(&testHashAble{val: uint64(i)})
+	}
+	n, found := st.Get("42")
+	if !found || n.Value.GetKey() != "42" {
+		t.Errorf("Get(42) = %v, %v", n, found)
+	}
+	if _, err := hashtable.NewShardedHashTable(0, 100); err == nil {
+		t.Error("no error for zero shards")
+	}
+}
+
+func benchmarkParallelSet(b *testing.B, set func(key string, value int)) {
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+			set(fmt.Sprintf("98%08d", i), int(i))
+		}
+	})
+}
+
+func BenchmarkParallelSetSingle(b *testing.B) {
+	hm, _ := generic.NewHashTable[string, int](1000, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2))
+	benchmarkParallelSet(b, func(key string, value int) { hm.Set(key, value) })
+}
+
+func BenchmarkParallelSetSharded(b *testing.B) {
+	st, _ := generic.NewShardedHashTable[string, int](16, 1000, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2))
+	benchmarkParallelSet(b, func(key string, value int) { st.Set(key, value) })
+}
+
+func TestShardedHashTableSize(t *testing.T) {
+	for _, size := range []int{4, 10, 11, 64} {
+		st, err := generic.NewShardedHashTable[string, int](4, size, nil, generic.WithHasher(generic.XXHash{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() != size || st.Distribution().Buckets != size {
+			t.Errorf("%d buckets asked, Size() = %d, %d in the distribution", size, st.Size(), st.Distribution().Buckets)
+		}
+	}
+}
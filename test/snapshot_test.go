@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"math"
+	"strings"
+	"testing"
+)
+
+// countingHasher counts the keys it hashes.
+type countingHasher struct {
+	calls int
+}
+
+func (c *countingHasher) Hash(key string, seed uint64) uint64 {
+	c.calls++
+	return generic.XXHash{}.Hash(key, seed)
+}
+
+func newSeededTable(t *testing.T, h generic.Hasher, seed uint64, opts ...generic.Option) *generic.HashTable[string, int] {
+	t.Helper()
+	opts = append([]generic.Option{generic.WithHasher(h), generic.WithSeed(seed)}, opts...)
+	hm, err := generic.NewHashTable[string, int](64, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hm
+}
+
+func TestHashTableSnapshotSeed(t *testing.T) {
+	const n = 300
+	src := newSeededTable(t, generic.XXHash{}, 42)
+	indexes := make(map[string]uint64, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("9801%06d", i*7)
+		indexes[key], _ = src.Set(key, i)
+	}
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	for _, tt := range []struct {
+		name   string
+		seed   uint64
+		rehash bool
+	}{
+		{"same seed", 42, false},
+		{"other seed", 7, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &countingHasher{}
+			dst := newSeededTable(t, h, tt.seed)
+			if err := dst.LoadSnapshot(bytes.NewReader(snapshot), generic.JSONCodec[string, int]{}); err != nil {
+				t.Fatal(err)
+			}
+			// One call fingerprints the hasher and seed.
+			if rehashed := h.calls > 1; rehashed != tt.rehash {
+				t.Errorf("hashed %d keys while loading, want rehash %v", h.calls, tt.rehash)
+			}
+			if got := len(dst.GetAllKeys()); got != n {
+				t.Fatalf("loaded %d keys, want %d", got, n)
+			}
+			for key, index := range indexes {
+				got, _ := dst.Set(key, -1)
+				want := generic.XXHash{}.Hash(key, tt.seed) % uint64(dst.Size())
+				if got != want {
+					t.Errorf("key %s is in bucket %d, want %d", key, got, want)
+				}
+				if !tt.rehash && got != index {
+					t.Errorf("key %s moved from bucket %d to %d", key, index, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHashTableSnapshotCorrupt(t *testing.T) {
+	src := newSeededTable(t, generic.FNV1a{}, 1)
+	for i := 0; i < 10; i++ {
+		src.Set(fmt.Sprint(i), i)
+	}
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	// The first entry follows the 41 byte header, its length is the last
+	// field of its 28 byte prefix.
+	huge := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(huge[41+24:], math.MaxUint32)
+	for name, snapshot := range map[string][]byte{
+		"truncated": data[:len(data)-3],
+		"flipped":   flipped,
+		"magic":     append([]byte("NOTASNAP"), data[8:]...),
+		"huge":      huge,
+	} {
+		dst := newSeededTable(t, generic.FNV1a{}, 1)
+		err := dst.LoadSnapshot(bytes.NewReader(snapshot), generic.JSONCodec[string, int]{})
+		if err == nil {
+			t.Errorf("%s snapshot loaded without error", name)
+		} else if name == "huge" && !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("huge entry length not rejected before reading: %v", err)
+		}
+		if keys := dst.GetAllKeys(); len(keys) != 0 {
+			t.Errorf("%s snapshot set %d keys", name, len(keys))
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/storage"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type intStore = storage.Store[string, int]
+
+func openStore(t *testing.T, dir string, opts ...storage.Option) *intStore {
+	t.Helper()
+	hm, err := generic.NewHashTable[string, int](16, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithAutoResize(0.25, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.Open[string, int](dir, hm, generic.JSONCodec[string, int]{}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// fill sets keys 0..n-1 and deletes every third one, returning what the
+// store should hold.
+func fill(t *testing.T, s *intStore, n int) map[string]int {
+	t.Helper()
+	want := make(map[string]int)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprint(9800 + i)
+		if err := s.Set(key, i); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = i
+	}
+	for i := 0; i < n; i += 3 {
+		key := fmt.Sprint(9800 + i)
+		if deleted, err := s.Delete(key); err != nil || !deleted {
+			t.Fatalf("Delete(%s) = %v, %v", key, deleted, err)
+		}
+		delete(want, key)
+	}
+	return want
+}
+
+func checkStore(t *testing.T, s *intStore, want map[string]int) {
+	t.Helper()
+	pairs := s.GetAllPairs()
+	if len(pairs) != len(want) {
+		t.Errorf("store holds %d keys, want %d", len(pairs), len(want))
+	}
+	for _, p := range pairs {
+		if v, ok := want[p.Key]; !ok || v != p.Value {
+			t.Errorf("store holds %s: %d, want %d (%v)", p.Key, p.Value, v, ok)
+		}
+	}
+}
+
+func TestStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	want := fill(t, s, 100)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("1", 1); err == nil {
+		t.Error("Set on a closed store succeeded")
+	}
+
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, want)
+}
+
+func TestStoreRejectedKey(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	s.Set("1", 1)
+	if err := s.Set("", 2); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("Set of the empty key: %v", err)
+	}
+	if err := s.SetWithTTL("", 2, time.Hour); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("SetWithTTL of the empty key: %v", err)
+	}
+	if _, err := s.CompareAndSet("", 2, 0); !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("CompareAndSet of the empty key: %v", err)
+	}
+	err := s.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Set("2", 2)
+		tx.Set("", 2)
+		return nil
+	})
+	if !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("Update with the empty key: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, map[string]int{"1": 1})
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, storage.WithCompactEvery(40))
+	want := fill(t, s, 100)
+	if err := s.Set("42", 42); err != nil {
+		t.Fatal(err)
+	}
+	want["42"] = 42
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 40*64 {
+		t.Errorf("log is %d bytes after compaction", info.Size())
+	}
+
+	s = openStore(t, dir)
+	checkStore(t, s, want)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if info, _ := os.Stat(filepath.Join(dir, "wal")); info.Size() != 0 {
+		t.Errorf("log is %d bytes after Compact", info.Size())
+	}
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, want)
+}
+
+func TestStoreTornRecord(t *testing.T) {
+	for name, damage := range map[string]func(data []byte) []byte{
+		"truncated": func(data []byte) []byte { return data[:len(data)-5] },
+		"header":    func(data []byte) []byte { return append(data, 1, 2, 3) },
+		"checksum": func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openStore(t, dir, storage.WithSync(storage.SyncNever))
+			want := fill(t, s, 30)
+			if err := s.Set("77", 77); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			if name == "header" {
+				want["77"] = 77
+			}
+
+			path := filepath.Join(dir, "wal")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, damage(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s = openStore(t, dir)
+			checkStore(t, s, want)
+			// Records appended after recovery must survive the next one.
+			if err := s.Set("78", 78); err != nil {
+				t.Fatal(err)
+			}
+			want["78"] = 78
+			s.Close()
+			s = openStore(t, dir)
+			defer s.Close()
+			checkStore(t, s, want)
+		})
+	}
+}
+
+func TestStoreSyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, storage.WithSyncInterval(time.Millisecond))
+	want := fill(t, s, 20)
+	time.Sleep(5 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, want)
+
+	hm, _ := generic.NewHashTable[string, int](16, nil, generic.WithHasher(generic.XXHash{}))
+	if _, err := storage.Open[string, int](t.TempDir(), hm, generic.JSONCodec[string, int]{}, storage.WithSyncInterval(0)); err == nil {
+		t.Error("Open with a sync interval of 0 succeeded")
+	}
+}
@@ -1,10 +1,16 @@
 package test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/matinhimself/trie/pkg/trie"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestTrieAdd(t *testing.T) {
@@ -96,3 +102,341 @@ func TestTrieGetValuePrefix(t *testing.T) {
 		}
 	}
 }
+
+func loadBenchTrie(n int) *trie.Trie {
+	tree := trie.NewTrie()
+	for i := 0; i < n; i++ {
+		tree.Insert(fmt.Sprintf("9801%08d", i*7), i)
+	}
+	return tree
+}
+
+func BenchmarkTrieGetAllKeys(b *testing.B) {
+	tree := loadBenchTrie(20000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.GetAllKeys()
+	}
+}
+
+func BenchmarkTrieGetPrefixKeys(b *testing.B) {
+	tree := loadBenchTrie(20000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.GetPrefixKeys("98010001")
+	}
+}
+
+func BenchmarkTrieGetPrefixValues(b *testing.B) {
+	tree := loadBenchTrie(20000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.GetPrefixValues("98010001")
+	}
+}
+
+func TestTrieKeysOrdered(t *testing.T) {
+	tree := trie.NewTrie()
+	keys := []string{"98", "9812", "1", "980", "9", "0", "9811", "1000"}
+	for i, key := range keys {
+		tree.Insert(key, i)
+	}
+	want := []string{"0", "1", "1000", "9", "98", "980", "9811", "9812"}
+	if got := tree.GetAllKeys(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetAllKeys = %v, want %v", got, want)
+	}
+	want = []string{"98", "980", "9811", "9812"}
+	if got := tree.GetPrefixKeys("98"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetPrefixKeys = %v, want %v", got, want)
+	}
+	if got := tree.GetPrefixKeys("97"); len(got) != 0 {
+		t.Errorf("GetPrefixKeys of missing prefix = %v", got)
+	}
+}
+
+func TestTrieWriteDOT(t *testing.T) {
+	tree := trie.NewTrie()
+	tree.Insert("98", 1)
+	tree.Insert("9812", 2)
+	tree.Insert("97", 3)
+
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf, trie.DOTOptions{Prefix: "98", MaxDepth: 1}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "digraph trie {") {
+		t.Errorf("unexpected DOT header:\n%s", out)
+	}
+	if strings.Count(out, "doublecircle") != 1 || !strings.Contains(out, `"..."`) {
+		t.Errorf("expected the prefix node and a cut off subtree:\n%s", out)
+	}
+	if strings.Contains(out, `xlabel="3"`) {
+		t.Errorf("key outside of the prefix was rendered:\n%s", out)
+	}
+}
+
+func TestTernaryTree(t *testing.T) {
+	tree := trie.NewTernaryTree()
+	for i := 0; i < 1000; i++ {
+		tree.Insert(strconv.Itoa(i), i)
+	}
+	tree.Insert("", 0)
+	if tree.Size() != 1000 {
+		t.Errorf("tree size is %d, want 1000", tree.Size())
+	}
+	for i := 0; i < 1000; i++ {
+		val, found := tree.Search(strconv.Itoa(i))
+		if !found || (*val).(int) != i {
+			t.Errorf("key %d not found in tree", i)
+		}
+	}
+	if keys := tree.GetAllKeys(); len(keys) != 1000 || !sort.StringsAreSorted(keys) {
+		t.Errorf("GetAllKeys returned %d keys, sorted: %v", len(keys), sort.StringsAreSorted(keys))
+	}
+	want := []string{"12", "120", "121", "122", "123", "124", "125", "126", "127", "128", "129"}
+	if got := tree.GetPrefixKeys("12"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetPrefixKeys = %v, want %v", got, want)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, deleted := tree.Delete(strconv.Itoa(i)); !deleted {
+			t.Errorf("key %d wasn't deleted", i)
+		}
+	}
+	if tree.Size() != 0 || len(tree.GetAllKeys()) != 0 {
+		t.Error("tree isn't empty after deleting all keys")
+	}
+}
+
+func TestTernaryTreeDeletePrunes(t *testing.T) {
+	tree := trie.NewTernaryTree()
+	for _, key := range []string{"car", "cart", "cat", "dog"} {
+		tree.Insert(key, key)
+	}
+	nodes := tree.Nodes()
+	tree.Insert("carton", "carton")
+	tree.Insert("do", "do")
+	tree.Delete("carton")
+	tree.Delete("do")
+	if n := tree.Nodes(); n != nodes {
+		t.Errorf("%d nodes after deleting the keys inserted last, want %d", n, nodes)
+	}
+
+	// A key that is a path of another keeps its nodes.
+	tree.Delete("car")
+	if n := tree.Nodes(); n != nodes {
+		t.Errorf("%d nodes after deleting car, want %d", n, nodes)
+	}
+	if _, found := tree.Search("cart"); !found {
+		t.Error("cart is gone after deleting car")
+	}
+	tree.Delete("cart")
+	tree.Upsert("dog", func(interface{}, bool) (interface{}, bool) { return nil, true })
+	if n := tree.Nodes(); n != 3 {
+		t.Errorf("%d nodes with cat left, want 3", n)
+	}
+	tree.Delete("cat")
+	if n := tree.Nodes(); n != 0 || tree.Size() != 0 {
+		t.Errorf("%d nodes and %d keys left after deleting every key", n, tree.Size())
+	}
+}
+
+func TestTrieCloneEqual(t *testing.T) {
+	tree := trie.NewTrie()
+	for i := 0; i < 100; i++ {
+		tree.Insert(strconv.Itoa(i), []int{i})
+	}
+	sliceEq := func(a, b interface{}) bool { return a.([]int)[0] == b.([]int)[0] }
+
+	clone := tree.Clone(func(value interface{}) interface{} {
+		return append([]int(nil), value.([]int)...)
+	})
+	if !tree.Equal(clone, sliceEq) {
+		t.Fatal("clone isn't equal to the original")
+	}
+
+	val, _ := clone.Search("42")
+	(*val).([]int)[0] = -1
+	if orig, _ := tree.Search("42"); (*orig).([]int)[0] != 42 {
+		t.Error("value of the clone is shared with the original")
+	}
+	if tree.Equal(clone, sliceEq) {
+		t.Error("tries with different values are equal")
+	}
+
+	clone.Insert("42", []int{42})
+	clone.Insert("1000", []int{1000})
+	clone.Delete("1000")
+	if !tree.Equal(clone, sliceEq) {
+		t.Error("deleted key left a difference behind")
+	}
+	clone.Delete("99")
+	if tree.Equal(clone, sliceEq) || clone.Equal(tree, sliceEq) {
+		t.Error("tries with different keys are equal")
+	}
+}
+
+func TestTrieEqualConcurrent(t *testing.T) {
+	// Readers and writers have to interleave for the lock order to matter.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	a, b := trie.NewTrie(), trie.NewTrie()
+	for i := 0; i < 100; i++ {
+		a.Insert(strconv.Itoa(i), i)
+		b.Insert(strconv.Itoa(i), i)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				a.Equal(b, nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				b.Equal(a, nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				a.Insert(strconv.Itoa(i), i)
+				b.Insert(strconv.Itoa(i), i)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Equal deadlocked")
+	}
+}
+
+func testUpsert(t *testing.T, tree trie.PrefixIndex) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				tree.Upsert(strconv.Itoa(i%10), func(old interface{}, exists bool) (interface{}, bool) {
+					if !exists {
+						return 1, true
+					}
+					return old.(int) + 1, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if val, _ := tree.Search(strconv.Itoa(i)); (*val).(int) != 800 {
+			t.Errorf("key %d was incremented %d times, want 800", i, (*val).(int))
+		}
+	}
+
+	if actual, loaded := tree.LoadOrStore("5", -1); !loaded || actual.(int) != 800 {
+		t.Errorf("LoadOrStore of existing key = %v, %v", actual, loaded)
+	}
+	if actual, loaded := tree.LoadOrStore("55", -1); loaded || actual.(int) != -1 {
+		t.Errorf("LoadOrStore of new key = %v, %v", actual, loaded)
+	}
+	if _, stored := tree.Upsert("56", func(interface{}, bool) (interface{}, bool) { return 1, false }); stored {
+		t.Error("Upsert stored a rejected value")
+	}
+	tree.Upsert("55", func(interface{}, bool) (interface{}, bool) { return nil, true })
+	if _, found := tree.Search("55"); found || tree.Size() != 10 {
+		t.Errorf("storing nil didn't delete the key, size %d", tree.Size())
+	}
+	tree.Insert("5", nil)
+	tree.Insert("57", nil)
+	if _, found := tree.Search("5"); found || tree.Size() != 9 {
+		t.Errorf("inserting nil didn't delete the key, size %d", tree.Size())
+	}
+}
+
+func TestTrieUpsert(t *testing.T) {
+	testUpsert(t, trie.NewTrie())
+}
+
+func TestTernaryTreeUpsert(t *testing.T) {
+	testUpsert(t, trie.NewTernaryTree())
+}
+
+func TestPrefixIndexWalk(t *testing.T) {
+	for name, tree := range map[string]trie.PrefixIndex{
+		"trie": trie.NewTrie(),
+		"tst":  trie.NewTernaryTree(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, k := range []string{"12", "1", "123", "2", "129", "3"} {
+				tree.Insert(k, k+"v")
+			}
+			var got []string
+			tree.Walk("12", func(key string, value interface{}) bool {
+				if value != key+"v" {
+					t.Errorf("key %s has value %v", key, value)
+				}
+				got = append(got, key)
+				return true
+			})
+			if fmt.Sprint(got) != "[12 123 129]" {
+				t.Errorf("Walk(12) visited %v", got)
+			}
+
+			got = got[:0]
+			tree.Walk("", func(key string, _ interface{}) bool {
+				got = append(got, key)
+				return len(got) < 4
+			})
+			if fmt.Sprint(got) != "[1 12 123 129]" {
+				t.Errorf("Walk stopped after %v", got)
+			}
+
+			tree.Walk("4", func(key string, _ interface{}) bool {
+				t.Errorf("Walk(4) visited %s", key)
+				return true
+			})
+		})
+	}
+}
+
+func TestPrefixIndexLoadOrStoreMany(t *testing.T) {
+	for name, tree := range map[string]trie.PrefixIndex{
+		"trie": trie.NewTrie(),
+		"tst":  trie.NewTernaryTree(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tree.Insert("12", "old")
+			keys := []string{"1", "12", "123", "12", "2", "1"}
+			values := []interface{}{"a", "b", "c", "d", "e", "f"}
+			actual, loaded := tree.LoadOrStoreMany(keys, values)
+			if got := fmt.Sprint(actual, loaded); got != "[a old c old e a] [false true false true false true]" {
+				t.Errorf("LoadOrStoreMany = %s", got)
+			}
+			if tree.Size() != 4 {
+				t.Errorf("Size() = %d, want 4", tree.Size())
+			}
+			if got := fmt.Sprint(tree.GetAllKeys()); got != "[1 12 123 2]" {
+				t.Errorf("keys = %s", got)
+			}
+			if tree.Accepts("") {
+				t.Error("empty key accepted")
+			}
+		})
+	}
+	if trie.NewTrie().Accepts("1a") {
+		t.Error("trie accepts a key with a letter")
+	}
+}
@@ -0,0 +1,278 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newExpiringTable(t *testing.T, clock *fakeClock, opts ...generic.Option) *generic.HashTable[string, int] {
+	t.Helper()
+	opts = append([]generic.Option{generic.WithHasher(generic.XXHash{}), generic.WithClock(clock.Now)}, opts...)
+	hm, err := generic.NewHashTable[string, int](16, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hm
+}
+
+func TestHashTableTTL(t *testing.T) {
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock)
+	events, cancel := hm.Watch("")
+	defer cancel()
+
+	hm.SetWithTTL("1", 1, time.Minute)
+	hm.SetWithTTL("2", 2, time.Hour)
+	hm.Set("3", 3)
+	hm.SetWithTTL("4", 4, time.Minute)
+	hm.Set("4", 4) // Set drops the expiry.
+	if at, ok := hm.ExpiresAt("1"); !ok || !at.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("ExpiresAt(1) = %v, %v", at, ok)
+	}
+
+	clock.Advance(time.Minute)
+	if _, found := hm.Get("1"); found {
+		t.Error("expired key 1 found")
+	}
+	if got := hm.GetAllKeys(); len(got) != 3 {
+		t.Errorf("GetAllKeys() = %v after expiry", got)
+	}
+	// The read removed the entry from the buckets and the trie.
+	if n := hm.Distribution().Entries; n != 3 {
+		t.Errorf("%d entries after reading an expired key, want 3", n)
+	}
+	if hm.Delete("1") {
+		t.Error("Delete of an expired key reported true")
+	}
+
+	clock.Advance(time.Hour)
+	if pairs := hm.GetPairsWithPrefix("2"); len(pairs) != 0 {
+		t.Errorf("expired key 2 listed: %v", pairs)
+	}
+	if n := hm.ExpireNow(); n != 1 || hm.Distribution().Entries != 2 {
+		t.Errorf("ExpireNow() = %d, %d entries left, want 1, 2", n, hm.Distribution().Entries)
+	}
+	if n := hm.ExpireNow(); n != 0 {
+		t.Errorf("second ExpireNow() = %d", n)
+	}
+
+	got, _ := drain(events)
+	want := "set 1 0>1;set 2 0>2;set 3 0>3;set 4 0>4;update 4 4>4;expire 1 1>0;expire 2 2>0;"
+	if s := formatEvents(got); s != want {
+		t.Errorf("events:\n%s\nwant\n%s", s, want)
+	}
+
+	// A key set again after expiring starts over.
+	hm.SetWithTTL("2", 5, time.Minute)
+	if value, found := hm.Get("2"); !found || value != 5 {
+		t.Errorf("Get(2) = %d, %v after setting it again", value, found)
+	}
+}
+
+func TestHashTableTTLOrderedIndex(t *testing.T) {
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock, generic.WithOrderedIndex("v", func(v int) float64 { return float64(v) }))
+	for i := 1; i <= 5; i++ {
+		hm.Set(fmt.Sprint(i), i)
+	}
+	hm.SetWithTTL("9", 9, time.Second)
+	clock.Advance(2 * time.Second)
+
+	top, err := hm.TopK("v", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(top); got != "[{5 5} {4 4} {3 3}]" {
+		t.Errorf("TopK(3) = %s with an expired entry on top", got)
+	}
+	if p, found, _ := hm.Percentile("v", 100); !found || p.Key != "5" {
+		t.Errorf("Percentile(100) = %v, %v", p, found)
+	}
+	if rank, found, _ := hm.Rank("v", "9"); found {
+		t.Errorf("expired key ranked %d", rank)
+	}
+	if rank, found, _ := hm.Rank("v", "5"); !found || rank != 4 {
+		t.Errorf("Rank(5) = %d, %v", rank, found)
+	}
+	if hm.Len() != 5 || hm.Distribution().Entries != 5 {
+		t.Errorf("Len() = %d, %d entries left", hm.Len(), hm.Distribution().Entries)
+	}
+}
+
+func TestHashTableJanitor(t *testing.T) {
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock, generic.WithJanitor(time.Millisecond))
+	defer hm.Close()
+	for _, key := range []string{"1", "2", "3"} {
+		hm.SetWithTTL(key, 0, time.Second)
+	}
+	hm.Set("4", 0)
+	clock.Advance(time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hm.Distribution().Entries != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := hm.Distribution().Entries; n != 1 {
+		t.Fatalf("%d entries left, the janitor didn't remove the expired keys", n)
+	}
+	if err := hm.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashTableTTLNanoseconds(t *testing.T) {
+	// Both expiries are 10ns apart, closer than a float64 resolves Unix
+	// nanoseconds, and 1 sorts after 2 by expiry but before it by key.
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock)
+	hm.SetUntil("1", 1, clock.Now().Add(20*time.Nanosecond))
+	hm.SetUntil("2", 2, clock.Now().Add(10*time.Nanosecond))
+	clock.Advance(10 * time.Nanosecond)
+
+	if n := hm.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1", n)
+	}
+	if n := hm.ExpireNow(); n != 1 {
+		t.Errorf("ExpireNow() = %d, want 1", n)
+	}
+	if n := hm.Distribution().Entries; n != 1 {
+		t.Errorf("%d entries left, want 1", n)
+	}
+	if _, ok := hm.Get("1"); !ok {
+		t.Error("key 1 expired early")
+	}
+	if err := hm.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHashTableSnapshotTTL(t *testing.T) {
+	clock := newFakeClock()
+	hm := newExpiringTable(t, clock)
+	hm.SetWithTTL("1", 1, time.Minute)
+	hm.SetWithTTL("2", 2, time.Second)
+	hm.Set("3", 3)
+	clock.Advance(time.Second)
+
+	var buf bytes.Buffer
+	if err := hm.WriteSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newExpiringTable(t, clock)
+	if err := loaded.LoadSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := loaded.Distribution().Entries; n != 2 {
+		t.Errorf("loaded %d entries, want 2", n)
+	}
+	want, _ := hm.ExpiresAt("1")
+	if at, ok := loaded.ExpiresAt("1"); !ok || !at.Equal(want) {
+		t.Errorf("loaded ExpiresAt(1) = %v, %v, want %v", at, ok, want)
+	}
+	if _, ok := loaded.ExpiresAt("3"); ok {
+		t.Error("key 3 expires after loading")
+	}
+}
+
+func TestHashTableSnapshotTTLClock(t *testing.T) {
+	// The clock moves on every reading once ticking, so an entry expires
+	// while the snapshot is being written.
+	clock := newFakeClock()
+	ticking := false
+	now := func() time.Time {
+		now := clock.Now()
+		if ticking {
+			clock.Advance(time.Second)
+		}
+		return now
+	}
+	hm, err := generic.NewHashTable[string, int](16, nil, generic.WithHasher(generic.XXHash{}), generic.WithClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm.SetWithTTL("1", 1, time.Second)
+	hm.Set("2", 2)
+
+	var buf bytes.Buffer
+	ticking = true
+	if err := hm.WriteSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	ticking = false
+	loaded := newExpiringTable(t, clock)
+	if err := loaded.LoadSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := loaded.Get("2"); !ok || v != 2 {
+		t.Errorf("loaded Get(2) = %v, %v, want 2, true", v, ok)
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+	open := func() *intStore {
+		s, err := storage.Open[string, int](dir, newExpiringTable(t, clock), generic.JSONCodec[string, int]{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	s := open()
+	if err := s.SetWithTTL("1", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetWithTTL("2", 2, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replayed from the log.
+	clock.Advance(time.Minute)
+	s = open()
+	checkStore(t, s, map[string]int{"2": 2})
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loaded from the snapshot.
+	s = open()
+	defer s.Close()
+	checkStore(t, s, map[string]int{"2": 2})
+	clock.Advance(time.Hour)
+	checkStore(t, s, map[string]int{})
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/matinhimself/trie/models"
+	"github.com/matinhimself/trie/pkg/hashtable"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"github.com/matinhimself/trie/pkg/hashtable/storage"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+type studentTx = generic.Tx[models.StudentID, *models.Student]
+
+func TestHashTableTransaction(t *testing.T) {
+	hm := newIndexedStudents(t)
+	ali := models.NewStudent("Ali Rezaei", "1", 17, "CE")
+	hm.Set(ali.StudentID, ali)
+
+	// Rename a student, checking the transaction reads its own writes.
+	renamed := models.NewStudent(ali.FullName, "2", ali.GPA, "EE")
+	err := hm.Update(func(tx *studentTx) error {
+		if _, taken := tx.Get("2"); taken {
+			return errors.New("taken")
+		}
+		if !tx.Delete("1") {
+			t.Error("Delete(1) = false")
+		}
+		tx.Set("2", renamed)
+		if _, found := tx.Get("1"); found {
+			t.Error("deleted key visible in the transaction")
+		}
+		if s, found := tx.Get("2"); !found || s != renamed {
+			t.Error("set key not visible in the transaction")
+		}
+		if n := len(tx.Changes()); n != 2 {
+			t.Errorf("transaction has %d changes, want 2", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := hm.Get("1"); found {
+		t.Error("old key still present after commit")
+	}
+	if s, found := hm.Get("2"); !found || s != renamed {
+		t.Error("new key missing after commit")
+	}
+	if pairs, _ := hm.GetByIndex("discipline", "EE"); pairKeys(pairs) != "[2]" {
+		t.Errorf("discipline index holds %s after commit", pairKeys(pairs))
+	}
+
+	// An error rolls everything back.
+	errAbort := errors.New("abort")
+	err = hm.Update(func(tx *studentTx) error {
+		tx.Delete("2")
+		tx.Set("3", ali)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("Update returned %v, want %v", err, errAbort)
+	}
+	if keys := fmt.Sprint(hm.GetAllKeys()); keys != "[2]" {
+		t.Errorf("keys after rollback are %s, want [2]", keys)
+	}
+
+	// So does a panic, which leaves the table unlocked.
+	var leaked *studentTx
+	func() {
+		defer func() { recover() }()
+		_ = hm.Update(func(tx *studentTx) error {
+			leaked = tx
+			tx.Set("4", ali)
+			panic("boom")
+		})
+	}()
+	if _, found := hm.Get("4"); found {
+		t.Error("change of a panicking transaction was applied")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("no panic using a finished transaction")
+			}
+		}()
+		leaked.Set("5", ali)
+	}()
+}
+
+// TestHashTableTransactionIsolation moves keys around in transactions
+// while readers check they never see a key missing or duplicated.
+func TestHashTableTransactionIsolation(t *testing.T) {
+	const keys, moves = 50, 2000
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	hm, _ := generic.NewHashTable[string, int](8, nil,
+		generic.WithHasher(generic.FNV1a{}), generic.WithAutoResize(0.25, 2))
+	for i := 0; i < keys; i++ {
+		hm.Set(fmt.Sprint(100+i), i)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pairs := hm.GetAllPairs()
+			seen := make(map[int]bool)
+			for _, p := range pairs {
+				seen[p.Value] = true
+			}
+			if len(pairs) != keys || len(seen) != keys {
+				t.Errorf("reader saw %d pairs with %d values, want %d", len(pairs), len(seen), keys)
+				return
+			}
+		}
+	}()
+
+	for m := 0; m < moves; m++ {
+		err := hm.Update(func(tx *generic.Tx[string, int]) error {
+			from := fmt.Sprint(100 + m%keys + m/keys%2*keys)
+			to := fmt.Sprint(100 + m%keys + (m/keys+1)%2*keys)
+			v, found := tx.Get(from)
+			if !found {
+				return fmt.Errorf("%s is missing", from)
+			}
+			tx.Delete(from)
+			tx.Set(to, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestHashTableTransactionRejectedKey(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1)
+	hm.Set("1", 1)
+	events, cancel := hm.Watch("")
+	defer cancel()
+
+	err := hm.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Set("123", 123)
+		tx.Delete("1")
+		tx.Set("", 0)
+		return nil
+	})
+	if !errors.Is(err, generic.ErrKeyRejected) {
+		t.Errorf("Update with the empty key: %v", err)
+	}
+	if got := fmt.Sprint(hm.GetAllPairs()); got != "[{1 1}]" || hm.Len() != 1 {
+		t.Errorf("pairs after the rejected transaction: %s", got)
+	}
+	if got, _ := drain(events); len(got) != 0 {
+		t.Errorf("events of the rejected transaction: %s", formatEvents(got))
+	}
+	if err := hm.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHashAbleTransaction(t *testing.T) {
+	hm, _ := hashtable.NewHashTable(16)
+	hm.Set(&testHashAble{val: 1})
+	err := hm.Update(func(tx *hashtable.Tx) error {
+		n, found := tx.Get("1")
+		if !found || n.Value.GetKey() != "1" {
+			return errors.New("1 is missing")
+		}
+		tx.Delete("1")
+		tx.Set(&testHashAble{val: 2})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := fmt.Sprint(hm.GetAllKeys()); keys != "[2]" {
+		t.Errorf("keys are %s, want [2]", keys)
+	}
+}
+
+func TestStoreTransaction(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, storage.WithSync(storage.SyncNever))
+	want := fill(t, s, 10)
+	err := s.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Delete("9801")
+		tx.Set("9900", 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(want, "9801")
+	want["9900"] = 1
+	if err := s.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Set("9901", 2)
+		return errors.New("abort")
+	}); err == nil {
+		t.Fatal("Update didn't return the error of fn")
+	}
+	s.Close()
+
+	s = openStore(t, dir)
+	checkStore(t, s, want)
+	s.Close()
+
+	// A torn batch is dropped as a whole.
+	s = openStore(t, dir)
+	err = s.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Set("9902", 3)
+		tx.Delete("9802")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	path := filepath.Join(dir, "wal")
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(data)-2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, want)
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"testing"
+)
+
+// versions returns the version of every key of hm.
+func versions(hm *generic.HashTable[string, int]) map[string]uint64 {
+	v := make(map[string]uint64)
+	for _, key := range hm.GetAllKeys() {
+		_, version, _ := hm.GetVersioned(key)
+		v[key] = version
+	}
+	return v
+}
+
+func TestHashTableVersions(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1)
+
+	if _, v, found := hm.GetVersioned("1"); found || v != 0 {
+		t.Errorf("missing key has version %d, %v", v, found)
+	}
+	hm.Set("1", 1)
+	_, v1, _ := hm.GetVersioned("1")
+	hm.Set("2", 1)
+	hm.Set("1", 2)
+	_, v2, _ := hm.GetVersioned("1")
+	if v1 == 0 || v2 <= v1 {
+		t.Errorf("versions of 1: %d, then %d", v1, v2)
+	}
+
+	// A key set again after a delete never gets an old version back.
+	hm.Delete("1")
+	hm.Set("1", 3)
+	if _, v3, _ := hm.GetVersioned("1"); v3 <= v2 {
+		t.Errorf("version after delete and set is %d, was %d", v3, v2)
+	}
+}
+
+func TestHashTableCompareAndSet(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1)
+
+	v1, err := hm.CompareAndSet("1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hm.CompareAndSet("1", 9, 0); err == nil {
+		t.Error("CompareAndSet of an existing key with version 0 succeeded")
+	}
+
+	v2, err := hm.CompareAndSet("1", 2, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A writer still holding v1 loses.
+	_, err = hm.CompareAndSet("1", 3, v1)
+	var conflict *generic.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("stale CompareAndSet returned %v", err)
+	}
+	if conflict.Key != "1" || conflict.Expected != v1 || conflict.Actual != v2 {
+		t.Errorf("conflict = %+v, want 1, %d, %d", *conflict, v1, v2)
+	}
+	if value, _ := hm.Get("1"); value != 2 {
+		t.Errorf("1 = %d after a conflict, want 2", value)
+	}
+
+	if err := hm.CompareAndDelete("1", v1); !errors.As(err, &conflict) {
+		t.Errorf("stale CompareAndDelete returned %v", err)
+	}
+	if err := hm.CompareAndDelete("1", v2); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := hm.Get("1"); found {
+		t.Error("1 still present after CompareAndDelete")
+	}
+	if err := hm.CompareAndDelete("1", 0); !errors.As(err, &conflict) {
+		t.Errorf("CompareAndDelete of a missing key returned %v", err)
+	}
+}
+
+func TestHashTableSnapshotVersions(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1)
+	for i, key := range []string{"1", "2", "3", "1", "4"} {
+		hm.Set(key, i)
+	}
+	hm.Delete("4")
+	_, last, _ := hm.GetVersioned("1")
+
+	var buf bytes.Buffer
+	if err := hm.WriteSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newSeededTable(t, generic.XXHash{}, 1)
+	if err := loaded.LoadSnapshot(&buf, generic.JSONCodec[string, int]{}); err != nil {
+		t.Fatal(err)
+	}
+	want, got := versions(hm), versions(loaded)
+	for key, v := range want {
+		if got[key] != v {
+			t.Errorf("version of %s is %d after loading, want %d", key, got[key], v)
+		}
+	}
+	// The revision is restored too, a new set doesn't reuse the version
+	// of the deleted 4.
+	loaded.Set("5", 0)
+	if _, v, _ := loaded.GetVersioned("5"); v <= last+1 {
+		t.Errorf("version of a new key is %d, want above %d", v, last+1)
+	}
+}
+
+func TestStoreCompareAndSet(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	v, err := s.CompareAndSet("1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompareAndSet("1", 2, v+1); err == nil {
+		t.Error("CompareAndSet with a wrong version succeeded")
+	}
+	if _, err := s.CompareAndSet("2", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompareAndDelete("2", v); err == nil {
+		t.Error("CompareAndDelete with a wrong version succeeded")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying the log gives the entries the same versions.
+	s = openStore(t, dir)
+	defer s.Close()
+	checkStore(t, s, map[string]int{"1": 1, "2": 1})
+	if _, err := s.CompareAndSet("1", 3, v); err != nil {
+		t.Errorf("CompareAndSet after reopening: %v", err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	_, va, _ := s.GetVersioned("1")
+	_, vb, _ := s.GetVersioned("2")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	defer s.Close()
+	if err := s.CompareAndDelete("2", vb); err != nil {
+		t.Errorf("CompareAndDelete after compacting: %v", err)
+	}
+	if _, err := s.CompareAndSet("1", 4, va); err != nil {
+		t.Errorf("CompareAndSet after compacting: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"fmt"
+	"github.com/matinhimself/trie/pkg/hashtable/generic"
+	"testing"
+)
+
+type intEvent = generic.Event[string, int]
+
+// drain reads the events buffered in ch without waiting for more.
+func drain(ch <-chan intEvent) (events []intEvent, closed bool) {
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return events, true
+			}
+			events = append(events, ev)
+		default:
+			return events, false
+		}
+	}
+}
+
+func formatEvents(events []intEvent) string {
+	s := ""
+	for _, ev := range events {
+		s += fmt.Sprintf("%v %s %d>%d;", ev.Kind, ev.Key, ev.Old, ev.New)
+	}
+	return s
+}
+
+func TestHashTableWatch(t *testing.T) {
+	hm := newSeededTable(t, generic.XXHash{}, 1)
+	hm.Set("10", 0)
+	all, cancelAll := hm.Watch("")
+	defer cancelAll()
+	ones, cancelOnes := hm.Watch("1")
+
+	hm.Set("11", 1)
+	hm.Set("20", 2)
+	hm.Set("11", 3)
+	hm.Delete("10")
+	hm.Delete("30")
+	if err := hm.Update(func(tx *generic.Tx[string, int]) error {
+		tx.Set("12", 4)
+		tx.Delete("11")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _ := drain(all)
+	want := "set 11 0>1;set 20 0>2;update 11 1>3;delete 10 0>0;set 12 0>4;delete 11 3>0;"
+	if got := formatEvents(events); got != want {
+		t.Errorf("all events:\n%s\nwant\n%s", got, want)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Version <= events[i-1].Version && events[i].Kind != generic.EventDelete {
+			t.Errorf("event %d has version %d after %d", i, events[i].Version, events[i-1].Version)
+		}
+	}
+
+	events, _ = drain(ones)
+	want = "set 11 0>1;update 11 1>3;delete 10 0>0;set 12 0>4;delete 11 3>0;"
+	if got := formatEvents(events); got != want {
+		t.Errorf("events of prefix 1:\n%s\nwant\n%s", got, want)
+	}
+
+	cancelOnes()
+	cancelOnes()
+	hm.Set("13", 5)
+	if events, closed := drain(ones); len(events) != 0 || !closed {
+		t.Errorf("canceled watcher got %d events, closed %v", len(events), closed)
+	}
+}
+
+func TestHashTableWatchSlowConsumer(t *testing.T) {
+	hm, err := generic.NewHashTable[string, int](16, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithWatchBuffer(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, cancel := hm.Watch("")
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		hm.Set(fmt.Sprint(i), i)
+	}
+
+	// The buffered events are kept, then the channel is closed.
+	events, closed := drain(slow)
+	if got, want := formatEvents(events), "set 0 0>0;set 1 0>1;set 2 0>2;"; got != want || !closed {
+		t.Errorf("slow watcher got %s closed %v, want %s closed", got, closed, want)
+	}
+	if _, err := generic.NewHashTable[string, int](16, nil,
+		generic.WithHasher(generic.XXHash{}), generic.WithWatchBuffer(-1)); err == nil {
+		t.Error("negative watch buffer accepted")
+	}
+}